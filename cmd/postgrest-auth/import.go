@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/importer"
+	"github.com/labstack/gommon/log"
+)
+
+// runImport imports the users of another auth system export, and returns the exit code
+func runImport(config *config.Config, args []string, logger *log.Logger) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: postgrest-auth import [options] <file>\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "csv", "The export format: auth0, firebase, supabase or csv")
+	dryRun := flags.Bool("dry-run", false, "Check the export without importing users")
+	reportPath := flags.String("report", "", "Write the errors report to this file instead of stderr")
+	var options importer.Options
+	flags.StringVar(&options.FirebaseSignerKey, "firebase-signer-key", "", "The base64 signer key of the Firebase project")
+	flags.StringVar(&options.FirebaseSaltSeparator, "firebase-salt-separator", "", "The base64 salt separator of the Firebase project")
+	flags.IntVar(&options.FirebaseRounds, "firebase-rounds", 8, "The rounds of the Firebase project")
+	flags.IntVar(&options.FirebaseMemCost, "firebase-mem-cost", 14, "The memory cost of the Firebase project")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		logger.Errorf("Unable to open export: %v", err.Error())
+		return 1
+	}
+	defer f.Close()
+	records, rowErrors, err := importer.Read(*format, f, &options)
+	if err != nil {
+		logger.Errorf("Unable to read export: %v", err.Error())
+		return 1
+	}
+
+	db, err := connect(config, logger)
+	if err != nil {
+		logger.Errorf("Unable to connect to database: %v", err.Error())
+		return 1
+	}
+	defer db.Close()
+	imported, importErrors := importer.Import(db, records, *dryRun)
+	rowErrors = append(rowErrors, importErrors...)
+
+	var report io.Writer = os.Stderr
+	if *reportPath != "" {
+		r, err := os.Create(*reportPath)
+		if err != nil {
+			logger.Errorf("Unable to create report: %v", err.Error())
+			return 1
+		}
+		defer r.Close()
+		report = r
+	}
+	for _, rowError := range rowErrors {
+		fmt.Fprintln(report, rowError.Error())
+	}
+
+	if *dryRun {
+		logger.Infof("Dry run: %v users can be imported, %v errors", imported, len(rowErrors))
+	} else {
+		logger.Infof("%v users imported, %v errors", imported, len(rowErrors))
+	}
+	if len(rowErrors) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"os/signal"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/alexandrevilain/postgrest-auth/pkg/api"
 	"github.com/alexandrevilain/postgrest-auth/pkg/config"
 	"github.com/alexandrevilain/postgrest-auth/pkg/mail"
+	"github.com/alexandrevilain/postgrest-auth/pkg/migrate"
 	"github.com/alexandrevilain/postgrest-auth/pkg/model"
 	"github.com/labstack/gommon/log"
 	_ "github.com/lib/pq"
@@ -21,27 +23,38 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Unable to load config file: %v", err.Error())
 	}
+	model.SetSchema(config.DB.Schema)
 
-	emailQueue := make(chan mail.EmailSendRequest, 100)
-	worker := mail.NewSenderWorker(emailQueue, &config.Email, logger)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+		case "import":
+			os.Exit(runImport(&config, os.Args[2:], logger))
+		case "migrate":
+			os.Exit(runMigrate(&config, os.Args[2:], logger))
+		case "preview":
+			os.Exit(runPreview(&config, os.Args[2:], logger))
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %q, available commands: serve, import, migrate, preview\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
 
-	db, err := sql.Open("postgres", config.DB.ConnectionString)
+	db, err := connect(&config, logger)
 	if err != nil {
 		logger.Fatalf("Unable to connect to database: %v", err.Error())
 	}
-	err = db.Ping()
+	worker, err := mail.NewSenderWorker(db, model.Table("email_queue"), &config.Email, logger)
 	if err != nil {
-		logger.Fatalf("Unable to connect to database: %v", err.Error())
+		logger.Fatalf("Unable to create email worker: %v", err.Error())
 	}
 
-	err = model.EnsureDBElementsExists(db, &config.DB, logger)
+	logger.Info("Starting postgrest-auth server ...")
+	err = api.Run(&config, db, logger)
 	if err != nil {
-		logger.Fatalf("Unable to create base elements on database: %v", err.Error())
+		logger.Fatalf("Unable to start postgrest-auth server: %v", err.Error())
 	}
 
-	logger.Info("Starting postgrest-auth server ...")
-	api.Run(&config, db, emailQueue, logger)
-
 	logger.Info("Stating email worker ...")
 	worker.Start()
 
@@ -53,10 +66,73 @@ func main() {
 	defer cancel()
 	// Stop API
 	api.Stop(ctx)
-	// Stop the Worker
+	// Stop the Worker, once the emails being sent are sent
 	worker.Stop()
 	// Close Database connection
 	db.Close()
 	logger.Info("Shutting down postgrest-auth server ...")
 	os.Exit(0)
 }
+
+// connect opens the database connection, and applies the pending migrations when automatic migration is enabled
+func connect(config *config.Config, logger *log.Logger) (*sql.DB, error) {
+	db, err := open(config.DB.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := autoMigrate(config, logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// autoMigrate applies the pending migrations using the admin connection when configured,
+// or only warns about them when automatic migration is disabled
+func autoMigrate(config *config.Config, logger *log.Logger) error {
+	db, err := openAdmin(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator := migrate.New(db, &config.DB, logger)
+	if config.DB.AutoMigrate {
+		if err := migrator.Up(); err != nil {
+			return fmt.Errorf("unable to migrate database: %v", err.Error())
+		}
+		return nil
+	}
+	pending, err := migrator.Pending()
+	if err != nil {
+		return fmt.Errorf("unable to check database migrations: %v", err.Error())
+	}
+	if pending > 0 {
+		logger.Warnf("%v database migrations are pending, run `postgrest-auth migrate up` to apply them", pending)
+	}
+	return nil
+}
+
+// open opens a database connection
+func open(connectionString string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openAdmin opens the database connection used to apply migrations
+// It falls back to the service connection when no admin connection is configured
+func openAdmin(config *config.Config) (*sql.DB, error) {
+	if config.DB.AdminConnectionString != "" {
+		return open(config.DB.AdminConnectionString)
+	}
+	return open(config.DB.ConnectionString)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/migrate"
+	"github.com/labstack/gommon/log"
+)
+
+// runMigrate applies, reverts or lists the database migrations, and returns the exit code
+func runMigrate(config *config.Config, args []string, logger *log.Logger) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: postgrest-auth migrate up|down [steps]|status\n")
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	db, err := openAdmin(config)
+	if err != nil {
+		logger.Errorf("Unable to connect to database: %v", err.Error())
+		return 1
+	}
+	defer db.Close()
+	migrator := migrate.New(db, &config.DB, logger)
+
+	switch flags.Arg(0) {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		steps := 1
+		if flags.NArg() > 1 {
+			steps, err = strconv.Atoi(flags.Arg(1))
+			if err != nil || steps < 1 {
+				flags.Usage()
+				return 2
+			}
+		}
+		err = migrator.Down(steps)
+	case "status":
+		var statuses []migrate.Status
+		statuses, err = migrator.Status()
+		if err == nil {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.AppliedAt != nil {
+					appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%v\t%v\t%v\n", status.Version, status.Name, appliedAt)
+			}
+			w.Flush()
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		logger.Errorf("Unable to migrate database: %v", err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/mail"
+	"github.com/labstack/gommon/log"
+)
+
+// runPreview renders an email template with sample data, and returns the exit code
+func runPreview(config *config.Config, args []string, logger *log.Logger) int {
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	email := flags.String("email", "john.doe@example.com", "the email address of the sample user")
+	locale := flags.String("locale", config.I18n.DefaultLocale, "the locale of the sample user")
+	link := flags.String("link", "http://localhost/example", "the link of the email's button")
+	text := flags.Bool("text", false, "render the plain text version instead of the html one")
+	out := flags.String("out", "", "write the email to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: postgrest-auth preview [flags] %v\n", strings.Join(mail.Templates(), "|"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	generator, err := mail.NewEmailGenerator(&config.App, config.I18n.DefaultLocale)
+	if err != nil {
+		logger.Errorf("Unable to load the email templates: %v", err.Error())
+		return 1
+	}
+	recipient := mail.Recipient{
+		ID:       "00000000-0000-0000-0000-000000000000",
+		Email:    *email,
+		Locale:   *locale,
+		Metadata: map[string]interface{}{},
+	}
+	details := map[string]string{"provider": "google", "device": "Mozilla/5.0 (X11; Linux x86_64) Firefox/115.0", "ip": "203.0.113.7", "country": "FR"}
+	generated, err := generator.Generate(flags.Arg(0), recipient, *link, details)
+	if err != nil {
+		logger.Errorf("Unable to render the email: %v", err.Error())
+		return 1
+	}
+
+	content := generated.HTML
+	if *text {
+		content = generated.Text
+	}
+	if *out != "" {
+		if err := ioutil.WriteFile(*out, []byte(content), 0644); err != nil {
+			logger.Errorf("Unable to write the email: %v", err.Error())
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Subject: %v\n", generated.Subject)
+		return 0
+	}
+	fmt.Printf("Subject: %v\n\n%v\n", generated.Subject, content)
+	return 0
+}
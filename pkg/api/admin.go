@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/labstack/echo"
+)
+
+// adminAuth only accepts the requests authenticated using the admin key as bearer token
+func (h *handler) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(h.config.API.AdminKey)) != 1 {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid admin key")
+		}
+		return next(c)
+	}
+}
+
+// listWebhookDeliveries returns the last webhook deliveries, optionally filtered using the status query param
+func (h *handler) listWebhookDeliveries(c echo.Context) error {
+	limit := 50
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "The limit must be between 1 and 500")
+		}
+		limit = parsed
+	}
+	deliveries, err := h.webhooks.List(c.QueryParam("status"), limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while listing the webhook deliveries")
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// retryWebhookDelivery schedules a new attempt of a webhook delivery
+func (h *handler) retryWebhookDelivery(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid delivery id")
+	}
+	err = h.webhooks.Retry(id)
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "Delivery not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while retrying the webhook delivery")
+	}
+	return c.JSON(http.StatusAccepted, map[string]bool{
+		"success": true,
+	})
+}
+
+type banRequest struct {
+	Until time.Time `json:"until"`
+}
+
+// banUser bans a user until the provided time, its tokens are rejected and its sessions are deleted
+func (h *handler) banUser(c echo.Context) error {
+	var request banRequest
+	if err := c.Bind(&request); err != nil || request.Until.IsZero() {
+		return echo.NewHTTPError(http.StatusBadRequest, "The until field is required")
+	}
+	user := model.User{ID: c.Param("id")}
+	err := user.Ban(h.db, request.Until)
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while banning the user")
+	}
+	return c.JSON(http.StatusOK, map[string]bool{
+		"success": true,
+	})
+}
+
+// unbanUser lifts the ban of a user
+func (h *handler) unbanUser(c echo.Context) error {
+	user := model.User{ID: c.Param("id")}
+	err := user.Unban(h.db)
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while unbanning the user")
+	}
+	return c.JSON(http.StatusOK, map[string]bool{
+		"success": true,
+	})
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/labstack/echo"
+)
+
+func TestBanUser(t *testing.T) {
+	h := &handler{config: &config.Config{}, db: newFakeDB(0)}
+	cases := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+	}{
+		{"missing until", "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", `{}`, http.StatusBadRequest},
+		{"invalid until", "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", `{"until": "tomorrow"}`, http.StatusBadRequest},
+		{"unknown user", "unknown", `{"until": "2030-01-01T00:00:00Z"}`, http.StatusNotFound},
+	}
+	e := echo.New()
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPut, "/admin/users/"+tc.id+"/ban", strings.NewReader(tc.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues(tc.id)
+		err := h.banUser(c)
+		if he, ok := err.(*echo.HTTPError); !ok || he.Code != tc.status {
+			t.Errorf("%s: expected a %d status, got: %v", tc.name, tc.status, err)
+		}
+	}
+}
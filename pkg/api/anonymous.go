@@ -0,0 +1,65 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+// signinAnonymous creates an anonymous user, and starts its session
+// The user is upgraded to a full account when it signs up, or signs in with a provider, using its token
+func (h *handler) signinAnonymous(c echo.Context) error {
+	if err := h.verifyCaptcha(c, "anonymous"); err != nil {
+		return err
+	}
+	var user model.User
+	user.Locale = h.userLocale(c, "")
+	if err := user.CreateAnonymous(h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your account")
+	}
+	token, refreshToken, err := h.issueTokens(c, &user)
+	if err != nil {
+		return err
+	}
+	return h.respondWithTokens(c, map[string]interface{}{
+		"user": user.GetMapRepresentation(),
+	}, token, refreshToken)
+}
+
+// anonymousUser returns the anonymous user authenticated by the request, or nil
+// The tokens which aren't valid are ignored, the request is then handled as a new signup
+func (h *handler) anonymousUser(c echo.Context) (*model.User, error) {
+	claims, err := h.parseToken(h.requestToken(c))
+	if err != nil {
+		return nil, nil
+	}
+	userID, _ := claims["userid"].(string)
+	if userID == "" {
+		return nil, nil
+	}
+	if sessionID, _ := claims["session_id"].(string); sessionID != "" {
+		exists, err := model.SessionExists(h.db, sessionID)
+		if err != nil || !exists {
+			return nil, err
+		}
+	}
+	user := &model.User{ID: userID}
+	err = user.FindByID(h.db)
+	if err == sql.ErrNoRows || (err == nil && !user.Anonymous) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// anonymousToken checks if the claims are the ones of an anonymous user, which didn't sign up yet
+func (h *handler) anonymousToken(claims jwt.MapClaims) bool {
+	userID, _ := claims["userid"].(string)
+	role, _ := claims["role"].(string)
+	return userID != "" && role == h.userRole(&model.User{Anonymous: true})
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+)
+
+func TestUserRole(t *testing.T) {
+	h := &handler{config: &config.Config{}}
+	h.config.DB.Roles.User = "normal_user"
+	h.config.DB.Roles.Anonymous = "anonymous"
+
+	if role := h.userRole(&model.User{}); role != "normal_user" {
+		t.Errorf("Expected the user role, got %s", role)
+	}
+	anonymous := &model.User{Anonymous: true}
+	if role := h.userRole(anonymous); role != "anonymous" {
+		t.Errorf("Expected the anonymous role, got %s", role)
+	}
+	h.config.Anonymous.Role = "visitor"
+	if role := h.userRole(anonymous); role != "visitor" {
+		t.Errorf("Expected the dedicated role, got %s", role)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// cookieSessions sets the tokens of the sessions as cookies, so browser apps don't have to store them
+// The cookies are protected against CSRF by a double-submit token, readable by the apps
+type cookieSessions struct {
+	enabled    bool
+	name       string
+	domain     string
+	path       string
+	secure     bool
+	sameSite   http.SameSite
+	csrfHeader string
+	tokenAge   time.Duration
+	refreshAge time.Duration
+}
+
+// newCookieSessions parses the cookie configuration and creates a new cookieSessions
+func newCookieSessions(config *config.Cookie, jwt *config.JWT) (*cookieSessions, error) {
+	sameSite, err := parseSameSite(config.SameSite)
+	if err != nil {
+		return nil, err
+	}
+	if sameSite == http.SameSiteNoneMode && !config.Secure {
+		return nil, fmt.Errorf("the SameSite=None cookies must be secure")
+	}
+	return &cookieSessions{
+		enabled:    config.Enabled,
+		name:       config.Name,
+		domain:     config.Domain,
+		path:       config.Path,
+		secure:     config.Secure,
+		sameSite:   sameSite,
+		csrfHeader: config.CSRFHeader,
+		tokenAge:   time.Duration(jwt.Exp) * time.Hour,
+		refreshAge: jwt.RefreshExpiry,
+	}, nil
+}
+
+// parseSameSite parses the SameSite attribute of the cookies
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("unknown cookie SameSite value: %s", value)
+}
+
+func (s *cookieSessions) refreshName() string {
+	return s.name + "_refresh"
+}
+
+func (s *cookieSessions) csrfName() string {
+	return s.name + "_csrf"
+}
+
+// cookie creates a cookie of the sessions, an empty value with a zero age deletes it
+func (s *cookieSessions) cookie(name, value string, age time.Duration, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   s.domain,
+		Path:     s.path,
+		Secure:   s.secure,
+		HttpOnly: httpOnly,
+		SameSite: s.sameSite,
+		MaxAge:   int(age.Seconds()),
+	}
+	if age == 0 {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+	}
+	return cookie
+}
+
+// set sets the tokens as cookies, and returns the CSRF token
+// The CSRF token of the request is kept, so the apps don't lose it when their session is refreshed
+// The refresh token cookie is kept too when the refresh token is empty
+func (s *cookieSessions) set(c echo.Context, token, refreshToken string) string {
+	csrfToken := s.value(c, s.csrfName())
+	if csrfToken == "" {
+		csrfToken = uuid.NewV4().String()
+	}
+	c.SetCookie(s.cookie(s.name, token, s.tokenAge, true))
+	if refreshToken != "" {
+		c.SetCookie(s.cookie(s.refreshName(), refreshToken, s.refreshAge, true))
+	}
+	c.SetCookie(s.cookie(s.csrfName(), csrfToken, s.refreshAge, false))
+	return csrfToken
+}
+
+// clear deletes the cookies of the session
+func (s *cookieSessions) clear(c echo.Context) {
+	for _, name := range []string{s.name, s.refreshName(), s.csrfName()} {
+		c.SetCookie(s.cookie(name, "", 0, name != s.csrfName()))
+	}
+}
+
+// value returns the value of a cookie of the request, or an empty string
+func (s *cookieSessions) value(c echo.Context, name string) string {
+	if !s.enabled {
+		return ""
+	}
+	cookie, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (s *cookieSessions) token(c echo.Context) string {
+	return s.value(c, s.name)
+}
+
+func (s *cookieSessions) refreshToken(c echo.Context) string {
+	return s.value(c, s.refreshName())
+}
+
+// used checks if the request is authenticated by the cookies rather than by a bearer token
+func (s *cookieSessions) used(c echo.Context) bool {
+	if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+		return false
+	}
+	return s.token(c) != "" || s.refreshToken(c) != ""
+}
+
+// csrf rejects the state-changing requests authenticated by the cookies without the CSRF token in the header
+func (s *cookieSessions) csrf(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if !s.used(c) {
+			return next(c)
+		}
+		expected := s.value(c, s.csrfName())
+		submitted := c.Request().Header.Get(s.csrfHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) != 1 {
+			return echo.NewHTTPError(http.StatusForbidden, "Your CSRF token is not valid")
+		}
+		return next(c)
+	}
+}
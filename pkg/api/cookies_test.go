@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/labstack/echo"
+)
+
+func TestParseSameSite(t *testing.T) {
+	cases := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"Strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}
+	for value, expected := range cases {
+		sameSite, err := parseSameSite(value)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", value, err)
+		}
+		if sameSite != expected {
+			t.Errorf("Expected %q to be parsed as %v, got %v", value, expected, sameSite)
+		}
+	}
+	if _, err := parseSameSite("relaxed"); err == nil {
+		t.Error("Expected an unknown value to be rejected")
+	}
+	if _, err := newCookieSessions(&config.Cookie{SameSite: "none"}, &config.JWT{}); err == nil {
+		t.Error("Expected insecure SameSite=None cookies to be rejected")
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	cookies, err := newCookieSessions(&config.Cookie{Enabled: true, Name: "auth", SameSite: "lax", CSRFHeader: "X-CSRF-Token"}, &config.JWT{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		method  string
+		cookies map[string]string
+		headers map[string]string
+		allowed bool
+	}{
+		{"safe method", http.MethodGet, map[string]string{"auth": "token"}, nil, true},
+		{"bearer token", http.MethodPost, map[string]string{"auth": "token"}, map[string]string{"Authorization": "Bearer token"}, true},
+		{"no session cookie", http.MethodPost, nil, nil, true},
+		{"missing header", http.MethodPost, map[string]string{"auth": "token", "auth_csrf": "csrf"}, nil, false},
+		{"missing cookie", http.MethodPost, map[string]string{"auth_refresh": "token"}, map[string]string{"X-CSRF-Token": "csrf"}, false},
+		{"wrong header", http.MethodDelete, map[string]string{"auth": "token", "auth_csrf": "csrf"}, map[string]string{"X-CSRF-Token": "other"}, false},
+		{"matching header", http.MethodPost, map[string]string{"auth_refresh": "token", "auth_csrf": "csrf"}, map[string]string{"X-CSRF-Token": "csrf"}, true},
+	}
+
+	e := echo.New()
+	handler := cookies.csrf(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		for name, value := range tc.cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+		if tc.allowed && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.allowed {
+			httpErr, ok := err.(*echo.HTTPError)
+			if !ok || httpErr.Code != http.StatusForbidden {
+				t.Errorf("%s: expected the request to be forbidden, got %v", tc.name, err)
+			}
+		}
+	}
+}
+
+func TestCookieSessionsSet(t *testing.T) {
+	cookies, err := newCookieSessions(&config.Cookie{Enabled: true, Name: "auth", SameSite: "lax"}, &config.JWT{Exp: 1, RefreshExpiry: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	for _, refreshToken := range []string{"refresh", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "auth_csrf", Value: "csrf"})
+		rec := httptest.NewRecorder()
+		if csrf := cookies.set(e.NewContext(req, rec), "token", refreshToken); csrf != "csrf" {
+			t.Errorf("Expected the CSRF token to be kept, got %q", csrf)
+		}
+		set := map[string]string{}
+		for _, cookie := range (&http.Response{Header: rec.Header()}).Cookies() {
+			set[cookie.Name] = cookie.Value
+		}
+		if set["auth"] != "token" {
+			t.Errorf("Expected the access token cookie to be set, got %v", set)
+		}
+		if value, ok := set["auth_refresh"]; ok != (refreshToken != "") || value != refreshToken {
+			t.Errorf("Unexpected refresh token cookie for %q: %v", refreshToken, set)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/mail"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/alexandrevilain/postgrest-auth/pkg/outbox"
+	"github.com/dchest/authcookie"
+)
+
+// sendConfirmEmail creates a confirmation token and queues the account confirmation email of the user
+func (h *handler) sendConfirmEmail(user *model.User) error {
+	token, err := user.CreateConfirmToken(h.db, h.config.API.ConfirmTokenExpiry)
+	if err != nil {
+		return err
+	}
+
+	confirmLink := fmt.Sprintf(h.config.Links.Confirm, user.ID, token)
+	return h.sendEmail(user, mail.TemplateConfirm, confirmLink, nil)
+}
+
+// sendResetEmail creates a reset token and queues the password reset email of the user
+func (h *handler) sendResetEmail(user *model.User) error {
+	if err := user.CreateResetToken(h.db, h.config.API.ResetToken); err != nil {
+		return err
+	}
+
+	token, err := user.ResetPasswordToken.Value()
+	if err != nil {
+		return err
+	}
+
+	resetLink := fmt.Sprintf(h.config.Links.Reset, token)
+	return h.sendEmail(user, mail.TemplateReset, resetLink, nil)
+}
+
+// sendUnlockEmail queues the account unlock email of the user
+func (h *handler) sendUnlockEmail(user *model.User) error {
+	token := authcookie.NewSinceNow(strings.ToLower(user.Email), h.config.Throttle.LockoutDuration, []byte(h.config.API.ResetToken))
+	unlockLink := fmt.Sprintf(h.config.Links.Unlock, token)
+	return h.sendEmail(user, mail.TemplateUnlock, unlockLink, nil)
+}
+
+// sendEmail renders the template for the user and queues the email
+func (h *handler) sendEmail(user *model.User, template, link string, details map[string]string) error {
+	email, err := h.emails.Generate(template, mail.Recipient{ID: user.ID, Email: user.Email, Locale: user.Locale, Metadata: user.Metadata}, link, details)
+	if err != nil {
+		return err
+	}
+
+	return h.emailQueue.Enqueue(mail.EmailSendRequest{
+		To:          user.Email,
+		Title:       email.Subject,
+		Content:     email.HTML,
+		Text:        email.Text,
+		Unsubscribe: email.Unsubscribe,
+	})
+}
+
+// processOutbox sends the emails requested by the SQL functions through the outbox table
+func (h *handler) processOutbox(message outbox.Message) error {
+	var user model.User
+	user.ID = message.UserID
+	if err := user.FindByID(h.db); err != nil {
+		return err
+	}
+	switch message.Kind {
+	case "confirm":
+		return h.sendConfirmEmail(&user)
+	case "reset":
+		return h.sendResetEmail(&user)
+	default:
+		return fmt.Errorf("unknown outbox message kind: %s", message.Kind)
+	}
+}
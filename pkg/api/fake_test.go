@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+)
+
+// fakeDatabase is a database/sql connector answering the session and revocation checks
+type fakeDatabase struct {
+	sessions  map[string]bool
+	revokedAt int64
+}
+
+func newFakeDB(revokedAt int64, sessions ...string) *sql.DB {
+	d := &fakeDatabase{sessions: make(map[string]bool), revokedAt: revokedAt}
+	for _, id := range sessions {
+		d.sessions[id] = true
+	}
+	return sql.OpenDB(d)
+}
+
+func (d *fakeDatabase) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+func (d *fakeDatabase) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	d *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements aren't supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	switch {
+	case strings.Contains(query, "sessions WHERE id"):
+		return &fakeRows{value: c.d.sessions[args[0].Value.(string)]}, nil
+	case strings.Contains(query, "tokensRevokedAt"):
+		return &fakeRows{value: c.d.revokedAt > args[1].Value.(int64)}, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+// fakeRows is a single row of a single value
+type fakeRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0] = r.value
+	r.done = true
+	return nil
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+// gatewayHeaders are the PostgREST request headers the browser apps can send through the gateway
+var gatewayHeaders = []string{"Prefer", "Range", "Range-Unit", "Accept-Profile", "Content-Profile"}
+
+// gatewayExposedHeaders are the PostgREST response headers readable by the browser apps
+var gatewayExposedHeaders = []string{"Content-Range", "Content-Location", "Location", "Preference-Applied"}
+
+// gateway forwards the requests to the PostgREST upstream, so browser apps only talk to one origin
+// The requests are authenticated with short-lived tokens minted from the session cookies or from an API key
+type gateway struct {
+	h      *handler
+	config *config.Gateway
+	proxy  *httputil.ReverseProxy
+}
+
+// newGateway creates the reverse proxy to the configured upstream
+func newGateway(h *handler, logger echo.Logger) (*gateway, error) {
+	config := &h.config.Gateway
+	upstream, err := url.Parse(config.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if upstream.Scheme == "" || upstream.Host == "" {
+		return nil, fmt.Errorf("the gateway upstream must be an absolute url: %s", config.Upstream)
+	}
+	prefix := strings.TrimSuffix(config.Prefix, "/")
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+		req.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefix)
+		director(req)
+		req.Host = upstream.Host
+	}
+	// Stream the responses, PostgREST can return large result sets
+	proxy.FlushInterval = -1
+	// The CORS headers are set by the service, the ones of the upstream would be duplicated
+	proxy.ModifyResponse = func(res *http.Response) error {
+		for name := range res.Header {
+			if strings.HasPrefix(name, "Access-Control-") {
+				res.Header.Del(name)
+			}
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		logger.Errorf("Unable to forward the request to the gateway upstream: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return &gateway{h: h, config: config, proxy: proxy}, nil
+}
+
+// serve authenticates the request and forwards it to the upstream
+// The requests without credentials are forwarded as is, to be handled as anonymous by PostgREST
+func (g *gateway) serve(c echo.Context) error {
+	req := c.Request()
+	token, err := g.token(c)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	req.Header.Del(g.config.APIKeyHeader)
+	if g.h.cookies.enabled {
+		removeCookies(req, g.h.cookies.name, g.h.cookies.refreshName(), g.h.cookies.csrfName())
+	}
+	g.proxy.ServeHTTP(c.Response(), req)
+	return nil
+}
+
+// token returns the token to forward, or an empty string to keep the Authorization header of the request
+func (g *gateway) token(c echo.Context) (string, error) {
+	if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+		return "", nil
+	}
+	claims, err := g.h.authenticate(c, true)
+	if err != nil || claims == nil {
+		return "", err
+	}
+	if err := g.h.checkSession(claims); err != nil {
+		return "", err
+	}
+	return g.mint(claims)
+}
+
+// mint signs a copy of the claims expiring after the gateway token expiry
+// The iat claim is kept, so the tokens of the revoked sessions are still rejected by check_token
+func (g *gateway) mint(claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	minted := jwt.MapClaims{}
+	for name, value := range claims {
+		minted[name] = value
+	}
+	if _, ok := minted["iat"]; !ok {
+		minted["iat"] = now.Unix()
+	}
+	exp := now.Add(g.config.TokenExpiry).Unix()
+	if current, ok := minted["exp"].(float64); ok && int64(current) < exp {
+		exp = int64(current)
+	}
+	minted["exp"] = exp
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, minted).SignedString([]byte(g.h.config.JWT.Secret))
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your token")
+	}
+	return token, nil
+}
+
+// removeCookies removes the named cookies from the request, so the session tokens aren't sent to the upstream
+func removeCookies(req *http.Request, names ...string) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		removed := false
+		for _, name := range names {
+			removed = removed || cookie.Name == name
+		}
+		if !removed {
+			req.AddCookie(cookie)
+		}
+	}
+}
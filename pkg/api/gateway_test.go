@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func TestGateway(t *testing.T) {
+	var forwarded *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Range", "0-0/1")
+		w.Write([]byte(`[{"id":1}]`))
+	}))
+	defer upstream.Close()
+
+	cookies, err := newCookieSessions(&config.Cookie{Enabled: true, Name: "auth", SameSite: "lax"}, &config.JWT{Exp: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := "0a8c3e1e-7a8e-4f5e-9b3a-2f4f0c6f1d2b"
+	h := &handler{config: &config.Config{}, cookies: cookies, db: newFakeDB(0, session)}
+	h.config.JWT.Secret = "secret"
+	h.config.Gateway = config.Gateway{
+		Upstream:     upstream.URL + "/rest",
+		Prefix:       "/api",
+		TokenExpiry:  time.Minute,
+		APIKeyHeader: "X-API-Key",
+		APIKeys:      map[string]string{"key": "service"},
+	}
+	e := echo.New()
+	g, err := newGateway(h, e.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Any("/api/*", g.serve)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	user := model.User{ID: "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", Email: "alexandre@google.com"}
+	sessionToken, err := user.CreateJWTToken("user", "secret", session, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedToken, err := user.CreateJWTToken("user", "secret", "5d7e8f9a-1b2c-4d3e-8f4a-5b6c7d8e9f0a", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		cookies map[string]string
+		headers map[string]string
+		role    string
+		status  int
+	}{
+		{"anonymous", nil, nil, "", http.StatusOK},
+		{"api key", nil, map[string]string{"X-API-Key": "key"}, "service", http.StatusOK},
+		{"wrong api key", nil, map[string]string{"X-API-Key": "other"}, "", http.StatusUnauthorized},
+		{"revoked session cookie", map[string]string{"auth": revokedToken}, nil, "", http.StatusUnauthorized},
+		{"session cookie", map[string]string{"auth": sessionToken, "auth_csrf": "csrf", "theme": "dark"}, nil, "user", http.StatusOK},
+	}
+	for _, tc := range cases {
+		forwarded = nil
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/todos?select=id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Prefer", "count=exact")
+		for name, value := range tc.cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Errorf("%s: expected a %d status, got %d", tc.name, tc.status, res.StatusCode)
+		}
+		if tc.status != http.StatusOK {
+			if forwarded != nil {
+				t.Errorf("%s: the request shouldn't be forwarded", tc.name)
+			}
+			continue
+		}
+		if forwarded == nil {
+			t.Fatalf("%s: the request wasn't forwarded", tc.name)
+		}
+		if forwarded.URL.Path != "/rest/todos" || forwarded.URL.RawQuery != "select=id" {
+			t.Errorf("%s: unexpected upstream url: %v", tc.name, forwarded.URL)
+		}
+		if forwarded.Header.Get("Prefer") != "count=exact" {
+			t.Errorf("%s: the Prefer header wasn't forwarded", tc.name)
+		}
+		if forwarded.Header.Get("X-API-Key") != "" || strings.Contains(forwarded.Header.Get("Cookie"), "auth") {
+			t.Errorf("%s: the credentials were forwarded: %v", tc.name, forwarded.Header)
+		}
+		authorization := forwarded.Header.Get("Authorization")
+		if tc.role == "" && authorization != "" {
+			t.Errorf("%s: unexpected authorization: %s", tc.name, authorization)
+		}
+		if tc.role != "" {
+			claims, err := h.parseToken(strings.TrimPrefix(authorization, "Bearer "))
+			if err != nil {
+				t.Fatalf("%s: invalid forwarded token: %v", tc.name, err)
+			}
+			if claims["role"] != tc.role {
+				t.Errorf("%s: expected the %s role, got %v", tc.name, tc.role, claims["role"])
+			}
+		}
+		if res.Header.Get("Access-Control-Allow-Origin") != "" || res.Header.Get("Content-Range") != "0-0/1" {
+			t.Errorf("%s: unexpected response headers: %v", tc.name, res.Header)
+		}
+	}
+	if !strings.Contains(forwarded.Header.Get("Cookie"), "theme=dark") {
+		t.Errorf("The other cookies should be forwarded, got %q", forwarded.Header.Get("Cookie"))
+	}
+}
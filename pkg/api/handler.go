@@ -3,23 +3,51 @@ package api
 import (
 	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/alexandrevilain/postgrest-auth/pkg/captcha"
 	"github.com/alexandrevilain/postgrest-auth/pkg/oauth"
 
 	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/hook"
+	"github.com/alexandrevilain/postgrest-auth/pkg/i18n"
 	"github.com/alexandrevilain/postgrest-auth/pkg/mail"
 	"github.com/alexandrevilain/postgrest-auth/pkg/model"
 	"github.com/alexandrevilain/postgrest-auth/pkg/oauth/facebook"
 	"github.com/alexandrevilain/postgrest-auth/pkg/oauth/google"
+	"github.com/alexandrevilain/postgrest-auth/pkg/password"
+	"github.com/alexandrevilain/postgrest-auth/pkg/throttle"
+	"github.com/alexandrevilain/postgrest-auth/pkg/webhook"
+	"github.com/dchest/authcookie"
 	"github.com/labstack/echo"
 )
 
+// captchaTokenHeader is the header containing the captcha token solved by the client
+const captchaTokenHeader = "X-Captcha-Token"
+
 type handler struct {
 	db         *sql.DB
 	config     *config.Config
-	emailQueue chan mail.EmailSendRequest
+	emailQueue *mail.Queue
 	emails     *mail.EmailGenerator
+	throttler  *throttle.Throttler
+	proxies    []*net.IPNet
+	captcha    captcha.Verifier
+	passwords  *password.Policy
+	hasher     password.Hasher
+	webhooks   *webhook.Store
+	hooks      *hook.Hooks
+	catalog    *i18n.Catalog
+	cookies    *cookieSessions
+}
+
+// clientIP returns the ip of the client, taking trusted proxies into account
+func (h *handler) clientIP(c echo.Context) string {
+	return clientIP(c.Request(), h.proxies)
 }
 
 func (h *handler) signin(c echo.Context) error {
@@ -27,27 +55,178 @@ func (h *handler) signin(c echo.Context) error {
 	if err := c.Bind(&user); err != nil {
 		return err
 	}
+	accountKey := throttle.AccountKey(strings.ToLower(user.Email))
+	ipKey := throttle.IPKey(h.clientIP(c))
+	wait, err := h.throttler.Check(accountKey, ipKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while checking your sign in attempts")
+	}
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if err := h.verifySigninCaptcha(c, accountKey, ipKey); err != nil {
+		return err
+	}
 	submittedPassword := user.Password
-	err := user.FindByEmail(h.db)
+	err = user.FindByEmail(h.db)
 	if err != nil {
+		h.failSignin(c, nil, accountKey, ipKey)
 		return echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
 	}
-	ok := user.CheckPassword(submittedPassword)
+	ok, rehash := user.CheckPassword(h.hasher, submittedPassword)
 	if !ok {
+		h.failSignin(c, &user, accountKey, ipKey)
 		return echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
 	}
+	// Upgrade the stored hash to the current hashing policy
+	if rehash {
+		if err := user.UpdatePassword(h.db, h.hasher, submittedPassword); err != nil {
+			c.Logger().Errorf("Unable to upgrade password hash: %v", err.Error())
+		}
+	}
+	if err := h.throttler.Reset(accountKey); err != nil {
+		c.Logger().Errorf("Unable to reset sign in attempts: %v", err.Error())
+	}
 	// Check for email confirmation
 	if !user.Confirmed {
 		return echo.NewHTTPError(http.StatusUnauthorized, "Please confirm your account")
 	}
-	jwt, err := user.CreateJWTToken(h.config.DB.Roles.User, h.config.JWT.Secret, h.config.JWT.Exp)
+	token, refreshToken, err := h.issueTokens(c, &user)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your token")
+		return err
 	}
+	h.triggerSignedIn(c, &user)
+	h.notifyNewSignin(c, &user)
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"user":  user.GetMapRepresentation(),
-		"token": jwt,
+	return h.respondWithTokens(c, map[string]interface{}{
+		"user": user.GetMapRepresentation(),
+	}, token, refreshToken)
+}
+
+// hookError converts the error of a hook to an http error
+func hookError(err error) error {
+	if rejected, ok := err.(*hook.RejectedError); ok {
+		return echo.NewHTTPError(http.StatusForbidden, rejected.Error())
+	}
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "An error occurred while checking your request, please retry later")
+}
+
+// triggerSignedIn sends the sign in webhook, a failure doesn't prevent the user from signing in
+func (h *handler) triggerSignedIn(c echo.Context, user *model.User) {
+	if err := h.webhooks.Trigger(webhook.EventUserSignedIn, user.GetMapRepresentation()); err != nil {
+		c.Logger().Errorf("Unable to trigger sign in webhook: %v", err.Error())
+	}
+}
+
+// failSignin records a failed sign in attempt, and sends an unlock email when the account gets locked
+// The user is nil when no account was found, the id bound from the request can't be trusted
+func (h *handler) failSignin(c echo.Context, user *model.User, accountKey, ipKey string) {
+	if _, err := h.throttler.Fail(ipKey, h.config.Throttle.IPMaxAttempts); err != nil {
+		c.Logger().Errorf("Unable to record sign in attempt: %v", err.Error())
+	}
+	locked, err := h.throttler.Fail(accountKey, h.config.Throttle.MaxAttempts)
+	if err != nil {
+		c.Logger().Errorf("Unable to record sign in attempt: %v", err.Error())
+		return
+	}
+	// Only existing accounts receive the unlock email
+	if !locked || user == nil {
+		return
+	}
+	if err := h.sendUnlockEmail(user); err != nil {
+		c.Logger().Errorf("Unable to send unlock email: %v", err.Error())
+	}
+}
+
+// tooManyAttempts returns a 429 error telling the client when to retry
+func tooManyAttempts(c echo.Context, wait time.Duration) error {
+	setRetryAfter(c, wait)
+	return echo.NewHTTPError(http.StatusTooManyRequests, "Too many failed attempts, please try again later")
+}
+
+// setRetryAfter sets the Retry-After header, rounded up to the next second
+func setRetryAfter(c echo.Context, wait time.Duration) {
+	seconds := int(wait / time.Second)
+	if wait%time.Second != 0 {
+		seconds++
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// captchaRequired checks if the endpoint is protected by a captcha
+func (h *handler) captchaRequired(endpoint string) bool {
+	if h.captcha == nil {
+		return false
+	}
+	for _, e := range h.config.Captcha.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCaptcha verifies the captcha token sent in the X-Captcha-Token header when the endpoint requires it
+func (h *handler) verifyCaptcha(c echo.Context, endpoint string) error {
+	if !h.captchaRequired(endpoint) {
+		return nil
+	}
+	err := h.captcha.Verify(c.Request().Header.Get(captchaTokenHeader), h.clientIP(c))
+	if err == captcha.ErrInvalidToken {
+		return echo.NewHTTPError(http.StatusForbidden, "The captcha verification failed")
+	}
+	if err != nil {
+		c.Logger().Errorf("Unable to verify captcha: %v", err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while verifying the captcha")
+	}
+	return nil
+}
+
+// verifySigninCaptcha verifies the captcha on signin once the account or the client ip reached the configured failures count
+func (h *handler) verifySigninCaptcha(c echo.Context, accountKey, ipKey string) error {
+	if !h.captchaRequired("signin") {
+		return nil
+	}
+	for _, key := range []string{accountKey, ipKey} {
+		failures, err := h.throttler.Failures(key)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while checking your sign in attempts")
+		}
+		if failures >= h.config.Captcha.SigninAfter {
+			return h.verifyCaptcha(c, "signin")
+		}
+	}
+	return nil
+}
+
+// validatePassword checks the password against the password policy
+// The returned error lists every rule the password doesn't match
+func (h *handler) validatePassword(password, email string) error {
+	violations, err := h.passwords.Validate(password, email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while checking your password")
+	}
+	if len(violations) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": "Your password doesn't match the password policy",
+			"errors":  violations,
+		})
+	}
+	return nil
+}
+
+// When a user clicks on the unlock link received by email
+func (h *handler) unlockAccount(c echo.Context) error {
+	email := authcookie.Login(c.Param("token"), []byte(h.config.API.ResetToken))
+	if email == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "Your unlock token is not valid")
+	}
+	if err := h.throttler.Reset(throttle.AccountKey(email)); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while unlocking your account")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]bool{
+		"success": true,
 	})
 }
 
@@ -56,33 +235,43 @@ func (h *handler) signup(c echo.Context) error {
 	if err := c.Bind(&user); err != nil {
 		return err
 	}
+	// The metadata is trusted, only the pre signup hook can set it
+	user.Metadata = nil
+	if err := h.verifyCaptcha(c, "signup"); err != nil {
+		return err
+	}
 	ok := user.CheckEmailDomain(h.config.API.AllowedDomains)
 	if !ok {
 		return echo.NewHTTPError(http.StatusBadRequest, "You're not allowed to create an account with the provied email address")
 	}
-	if err := user.HashPassword(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while hashing your password")
+	if err := h.validatePassword(user.Password, user.Email); err != nil {
+		return err
 	}
-
-	if err := user.Create(h.db); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your account")
+	user.Locale = h.userLocale(c, user.Locale)
+	if err := h.hooks.PreSignup(&user); err != nil {
+		return hookError(err)
+	}
+	if err := user.HashPassword(h.hasher); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while hashing your password")
 	}
 
-	token, err := user.ConfirmToken.Value()
+	// An anonymous user keeps its id, so the data it created stays its own
+	anonymous, err := h.anonymousUser(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your account")
 	}
-
-	confirmLink := fmt.Sprintf(h.config.Links.Confirm, user.ID, token)
-	email, err := h.emails.GenerateConfirmEmail(user.Email, confirmLink)
+	if anonymous != nil {
+		user.ID = anonymous.ID
+		err = user.Upgrade(h.db, false)
+	} else {
+		err = user.Create(h.db)
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your account")
 	}
 
-	h.emailQueue <- mail.EmailSendRequest{
-		To:      user.Email,
-		Title:   "Please confirm your account",
-		Content: email,
+	if err := h.sendConfirmEmail(&user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your account")
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
@@ -97,12 +286,12 @@ func (h *handler) confirmAccount(c echo.Context) error {
 	if err := user.FindByID(h.db); err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
 	}
-	token, err := user.ConfirmToken.Value()
-	if err != nil {
+	valid, expired := user.CheckConfirmToken(c.QueryParam("token"))
+	if !valid {
 		return echo.NewHTTPError(http.StatusForbidden, "Your email confirmation token is not valid")
 	}
-	if token != c.QueryParam("token") {
-		return echo.NewHTTPError(http.StatusForbidden, "Your email confirmation token is not valid")
+	if expired {
+		return echo.NewHTTPError(http.StatusForbidden, "Your email confirmation token has expired, please ask for a new one")
 	}
 
 	if err := user.UpdateStatus(h.db, true); err != nil {
@@ -114,36 +303,45 @@ func (h *handler) confirmAccount(c echo.Context) error {
 	})
 }
 
+// resendConfirmation sends a new confirmation email to an unconfirmed user
+// It answers the same way whether the account exists or not, so it can't be used to find the registered emails
+func (h *handler) resendConfirmation(c echo.Context) error {
+	var user model.User
+	if err := c.Bind(&user); err != nil {
+		return err
+	}
+	if err := h.verifyCaptcha(c, "resend"); err != nil {
+		return err
+	}
+	err := user.FindByEmail(h.db)
+	if err == nil && !user.Confirmed {
+		err = h.sendConfirmEmail(&user)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.Logger().Errorf("Unable to resend confirmation email: %v", err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]bool{
+		"success": true,
+	})
+}
+
 // When a user ask for passwork reset
 func (h *handler) sendPasswordReset(c echo.Context) error {
 	var user model.User
 	if err := c.Bind(&user); err != nil {
 		return err
 	}
+	if err := h.verifyCaptcha(c, "reset"); err != nil {
+		return err
+	}
 	if err := user.FindByEmail(h.db); err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
 	}
-	if err := user.CreateResetToken(h.db, h.config.API.ResetToken); err != nil {
+	if err := h.sendResetEmail(&user); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your reset password")
 	}
 
-	token, err := user.ResetPasswordToken.Value()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your reset password")
-	}
-
-	resetLink := fmt.Sprintf(h.config.Links.Reset, token)
-	email, err := h.emails.GenerateRestePasswordEmail(user.Email, resetLink)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your reset password")
-	}
-
-	h.emailQueue <- mail.EmailSendRequest{
-		To:      user.Email,
-		Title:   "Here is your reset link",
-		Content: email,
-	}
-
 	return c.JSON(http.StatusCreated, map[string]bool{
 		"success": true,
 	})
@@ -167,16 +365,58 @@ func (h *handler) resetPassword(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Wrong reset token")
 	}
+	if err := h.validatePassword(req.Password, user.Email); err != nil {
+		return err
+	}
 
-	if err := user.UpdatePassword(h.db, req.Password); err != nil {
+	if err := user.ResetPassword(h.db, h.hasher, req.Password); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while updating your password")
 	}
+	h.notify(c, &user, mail.TemplatePasswordChanged, nil)
 
 	return c.JSON(http.StatusCreated, map[string]bool{
 		"success": true,
 	})
 }
 
+// findOrCreateProviderUser loads the user linked to the provider account, otherwise a new account is created
+// Existing accounts using the same email address aren't linked, the provider may not have verified it
+// The anonymous user, when not nil, is upgraded instead of creating a new user
+func (h *handler) findOrCreateProviderUser(user *model.User, identity model.Identity, anonymous *model.User) error {
+	email := user.Email
+	err := user.FindByIdentity(h.db, identity)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	err = user.FindByEmail(h.db)
+	if err == nil {
+		return fmt.Errorf("an account already exists with this email address")
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	user.Email = email
+	if err := h.hooks.PreSignup(user); err != nil {
+		return hookError(err)
+	}
+	if err := user.CreateRandomPassword(h.hasher, 12); err != nil {
+		return err
+	}
+	if anonymous != nil {
+		user.ID = anonymous.ID
+		err = user.Upgrade(h.db, true)
+	} else {
+		err = user.Create(h.db)
+	}
+	if err != nil {
+		return err
+	}
+	return user.LinkIdentity(h.db, identity)
+}
+
 func (h *handler) signinWithProvider(c echo.Context) error {
 	payload := new(oauth.Oauth2Payload)
 
@@ -193,24 +433,30 @@ func (h *handler) signinWithProvider(c echo.Context) error {
 	default:
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("%s provider is not supported", provider))
 	}
-	user, err := p.GetUserInfo(payload, h.config.OAuth2.State)
+	user, identity, err := p.GetUserInfo(payload, h.config.OAuth2.State)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	if err := user.CreateRandomPassword(12); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("An error occurred while creating your account :  %s", err.Error()))
+	user.Locale = h.userLocale(c, user.Locale)
+	anonymous, err := h.anonymousUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your account")
 	}
-	if err := user.Create(h.db); err != nil {
+	if err := h.findOrCreateProviderUser(&user, identity, anonymous); err != nil {
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			return httpErr
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("An error occurred while creating your account:  %s", err.Error()))
 	}
-	token, err := user.CreateJWTToken(h.config.DB.Roles.User, h.config.JWT.Secret, h.config.JWT.Exp)
+	token, refreshToken, err := h.issueTokens(c, &user)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("An error occurred while creating your jwt token:  %s", err.Error()))
+		return err
 	}
+	h.triggerSignedIn(c, &user)
+	h.notifyNewSignin(c, &user)
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"user":  user.GetMapRepresentation(),
-		"token": token,
-	})
+	return h.respondWithTokens(c, map[string]interface{}{
+		"user": user.GetMapRepresentation(),
+	}, token, refreshToken)
 
 }
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/labstack/echo"
+)
+
+// localizeErrors translates the messages of the http errors in the locale requested by the Accept-Language header
+func (h *handler) localizeErrors(next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if he, ok := err.(*echo.HTTPError); ok {
+			locale := h.catalog.Match(c.Request().Header.Get("Accept-Language"))
+			localized := *he
+			switch message := he.Message.(type) {
+			case string:
+				localized.Message = h.catalog.Translate(locale, message)
+			case map[string]interface{}:
+				fields := make(map[string]interface{}, len(message))
+				for key, value := range message {
+					fields[key] = value
+				}
+				if text, ok := fields["message"].(string); ok {
+					fields["message"] = h.catalog.Translate(locale, text)
+				}
+				localized.Message = fields
+			}
+			err = &localized
+		}
+		next(err, c)
+	}
+}
+
+// userLocale returns the locale of a new user: the provided one when it is supported, otherwise the one of the Accept-Language header
+func (h *handler) userLocale(c echo.Context, locale string) string {
+	if supported := h.catalog.Supported(locale); supported != "" {
+		return supported
+	}
+	return h.catalog.Match(c.Request().Header.Get("Accept-Language"))
+}
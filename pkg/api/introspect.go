@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+// clientAuth only accepts the requests of the introspection clients, authenticated using http basic authentication
+func (h *handler) clientAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, secret, ok := c.Request().BasicAuth()
+		expected, known := h.config.API.IntrospectionClients[id]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) != 1 {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="introspection"`)
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid client credentials")
+		}
+		return next(c)
+	}
+}
+
+// introspect reports if an access token is active, and returns its claims, as described by RFC 7662
+func (h *handler) introspect(c echo.Context) error {
+	token := c.FormValue("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "The token parameter is required")
+	}
+	inactive := map[string]bool{
+		"active": false,
+	}
+	claims, err := h.parseToken(token)
+	if err != nil {
+		return c.JSON(http.StatusOK, inactive)
+	}
+	active, err := h.tokenActive(claims)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while checking the token")
+	}
+	if !active {
+		return c.JSON(http.StatusOK, inactive)
+	}
+
+	response := map[string]interface{}{}
+	for name, value := range claims {
+		response[name] = value
+	}
+	response["active"] = true
+	response["token_type"] = "access_token"
+	if userID, _ := claims["userid"].(string); userID != "" {
+		response["sub"] = userID
+		response["username"] = claims["email"]
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// tokenActive checks that the session of a token wasn't deleted, and that the tokens of its user weren't revoked
+// The tokens without user, minted from the API keys, are active until they expire
+// It is shared by the introspection, the authenticated endpoints and the verify endpoint
+func (h *handler) tokenActive(claims jwt.MapClaims) (bool, error) {
+	if sessionID, _ := claims["session_id"].(string); sessionID != "" {
+		exists, err := model.SessionExists(h.db, sessionID)
+		if err != nil || !exists {
+			return false, err
+		}
+	}
+	userID, _ := claims["userid"].(string)
+	if userID == "" {
+		return true, nil
+	}
+	issuedAt, _ := claims["iat"].(float64)
+	user := model.User{ID: userID}
+	revoked, err := user.TokensRevoked(h.db, int64(issuedAt))
+	return !revoked, err
+}
+
+// userinfo returns the user of the access token
+func (h *handler) userinfo(c echo.Context) error {
+	var user model.User
+	user.ID = c.Get(contextUserID).(string)
+	if err := user.FindByID(h.db); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
+	}
+	return c.JSON(http.StatusOK, user.GetMapRepresentation())
+}
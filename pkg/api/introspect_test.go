@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+func TestIntrospect(t *testing.T) {
+	h := &handler{config: &config.Config{}}
+	h.config.JWT.Secret = "secret"
+	h.config.API.IntrospectionClients = map[string]string{"grafana": "client-secret"}
+	e := echo.New()
+	e.POST("/introspect", h.introspect, h.clientAuth)
+
+	// Tokens without user, as the ones minted from the API keys, don't require a database lookup
+	serviceToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"role": "service", "exp": 4102444800}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		client string
+		secret string
+		token  string
+		status int
+		active bool
+	}{
+		{"unknown client", "other", "client-secret", serviceToken, http.StatusUnauthorized, false},
+		{"wrong secret", "grafana", "wrong", serviceToken, http.StatusUnauthorized, false},
+		{"missing token", "grafana", "client-secret", "", http.StatusBadRequest, false},
+		{"invalid token", "grafana", "client-secret", "invalid", http.StatusOK, false},
+		{"active token", "grafana", "client-secret", serviceToken, http.StatusOK, true},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {tc.token}}.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.SetBasicAuth(tc.client, tc.secret)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: expected a %d status, got %d", tc.name, tc.status, rec.Code)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response["active"] != tc.active {
+			t.Errorf("%s: expected active to be %v, got %v", tc.name, tc.active, response)
+		}
+		if tc.active && response["role"] != "service" {
+			t.Errorf("%s: expected the claims of the token, got %v", tc.name, response)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/mail"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/dchest/authcookie"
+	"github.com/labstack/echo"
+)
+
+// revokePrefix prefixes the user id in the login of the revoke tokens, so they can't be mistaken for unlock tokens
+const revokePrefix = "revoke "
+
+// notify queues a security notification email, if enabled, with a link revoking the sessions of the user
+// A failure is logged, it doesn't fail the request
+func (h *handler) notify(c echo.Context, user *model.User, template string, details map[string]string) {
+	enabled := false
+	for _, event := range h.config.Notifications.Events {
+		enabled = enabled || event == template
+	}
+	if !enabled {
+		return
+	}
+	token := authcookie.NewSinceNow(revokePrefix+user.ID, h.config.Notifications.RevokeExpiry, []byte(h.config.API.ResetToken))
+	revokeLink := fmt.Sprintf(h.config.Links.Revoke, token)
+	if err := h.sendEmail(user, template, revokeLink, details); err != nil {
+		c.Logger().Errorf("Unable to send the %v notification: %v", template, err.Error())
+	}
+}
+
+// notifyNewSignin notifies the user when it signs in from a device it never used
+// Devices are identified by their user agent, and their country when the country header is configured
+func (h *handler) notifyNewSignin(c echo.Context, user *model.User) {
+	device := c.Request().UserAgent()
+	var country string
+	if h.config.Notifications.CountryHeader != "" {
+		country = c.Request().Header.Get(h.config.Notifications.CountryHeader)
+	}
+	fingerprint := sha256.Sum256([]byte(device + "\n" + country))
+	isNew, err := user.RememberDevice(h.db, hex.EncodeToString(fingerprint[:]))
+	if err != nil {
+		c.Logger().Errorf("Unable to remember the sign in device: %v", err.Error())
+		return
+	}
+	if isNew {
+		h.notify(c, user, mail.TemplateNewSignin, map[string]string{"device": device, "ip": h.clientIP(c), "country": country})
+	}
+}
+
+// revokeSessions handles the link of the security notifications
+// It revokes the tokens of the user and sends a password reset email
+func (h *handler) revokeSessions(c echo.Context) error {
+	login := authcookie.Login(c.Param("token"), []byte(h.config.API.ResetToken))
+	if !strings.HasPrefix(login, revokePrefix) {
+		return echo.NewHTTPError(http.StatusForbidden, "Your revoke token is not valid")
+	}
+	var user model.User
+	user.ID = strings.TrimPrefix(login, revokePrefix)
+	if err := user.FindByID(h.db); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
+	}
+	if err := user.RevokeTokens(h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while revoking your sessions")
+	}
+	if err := h.sendResetEmail(&user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your reset password")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]bool{
+		"success": true,
+	})
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/ratelimit"
+	"github.com/labstack/echo"
+)
+
+// rateLimiter applies per route and per client ip token bucket limits
+type rateLimiter struct {
+	store    ratelimit.Store
+	enabled  bool
+	defaults ratelimit.Limit
+	email    ratelimit.Limit
+	routes   map[string]ratelimit.Limit
+	clientIP func(c echo.Context) string
+}
+
+// newRateLimiter parses the configured limits and creates a new rateLimiter
+func newRateLimiter(config *config.RateLimit, store ratelimit.Store, clientIP func(c echo.Context) string) (*rateLimiter, error) {
+	l := &rateLimiter{
+		store:    store,
+		enabled:  config.Enabled,
+		routes:   make(map[string]ratelimit.Limit),
+		clientIP: clientIP,
+	}
+	var err error
+	if l.defaults, err = ratelimit.ParseLimit(config.Default); err != nil {
+		return nil, err
+	}
+	if l.email, err = ratelimit.ParseLimit(config.Email); err != nil {
+		return nil, err
+	}
+	for route, value := range config.Routes {
+		if l.routes[route], err = ratelimit.ParseLimit(value); err != nil {
+			return nil, fmt.Errorf("route %s: %v", route, err)
+		}
+	}
+	return l, nil
+}
+
+// route returns the middleware limiting the named route
+// Routes sending emails use the email limit unless a route-specific limit is configured
+func (l *rateLimiter) route(name string, sendsEmail bool) echo.MiddlewareFunc {
+	limit, ok := l.routes[name]
+	if !ok {
+		limit = l.defaults
+		if sendsEmail {
+			limit = l.email
+		}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !l.enabled {
+			return next
+		}
+		return func(c echo.Context) error {
+			allowed, wait, err := l.store.Take(name+":"+l.clientIP(c), limit, time.Now())
+			if err != nil {
+				c.Logger().Errorf("Unable to apply rate limit: %v", err.Error())
+				return next(c)
+			}
+			if !allowed {
+				setRetryAfter(c, wait)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests, please try again later")
+			}
+			return next(c)
+		}
+	}
+}
+
+// parseTrustedProxies parses a list of ip addresses or CIDR ranges
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// clientIP returns the ip of the client which sent the request
+// X-Forwarded-For is only used when the request comes from a trusted proxy,
+// in that case the right-most untrusted address is the client
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
+	var forwarded []string
+	for _, header := range r.Header[echo.HeaderXForwardedFor] {
+		for _, ip := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(ip))
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if !isTrusted(forwarded[i], trusted) {
+			return forwarded[i]
+		}
+	}
+	if len(forwarded) > 0 {
+		return forwarded[0]
+	}
+	return remote
+}
+
+// isTrusted checks if the ip belongs to one of the trusted networks
+func isTrusted(value string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
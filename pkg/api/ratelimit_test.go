@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		ip         string
+	}{
+		{"203.0.113.1:1234", "", "203.0.113.1"},
+		{"203.0.113.1:1234", "198.51.100.1", "203.0.113.1"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "1.1.1.1, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "10.0.0.2", "10.0.0.2"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodPost, "/signin", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		ip := clientIP(r, trusted)
+		if ip != test.ip {
+			t.Errorf("Expected client ip of %v (forwarded for %v) to be %v, got: %v", test.remoteAddr, test.forwarded, test.ip, ip)
+		}
+	}
+}
@@ -3,42 +3,171 @@ package api
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	"github.com/labstack/gommon/log"
+	"github.com/alexandrevilain/postgrest-auth/pkg/captcha"
 	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/events"
+	"github.com/alexandrevilain/postgrest-auth/pkg/hook"
+	"github.com/alexandrevilain/postgrest-auth/pkg/i18n"
 	"github.com/alexandrevilain/postgrest-auth/pkg/mail"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/alexandrevilain/postgrest-auth/pkg/outbox"
+	"github.com/alexandrevilain/postgrest-auth/pkg/password"
+	"github.com/alexandrevilain/postgrest-auth/pkg/ratelimit"
+	"github.com/alexandrevilain/postgrest-auth/pkg/throttle"
+	"github.com/alexandrevilain/postgrest-auth/pkg/webhook"
 )
 
 var server *echo.Echo
+var outboxWorker *outbox.Worker
+var webhookWorker *webhook.Worker
+var subscriber *events.Subscriber
+var stopRelay context.CancelFunc
 
 // Run starts the API server
-func Run(config *config.Config, db *sql.DB, emailQueue chan mail.EmailSendRequest, logger *log.Logger) {
+func Run(config *config.Config, db *sql.DB, logger *log.Logger) error {
+	throttleStore, err := throttle.NewStore(config.Throttle.Store, db, model.Table("login_attempts"))
+	if err != nil {
+		return err
+	}
+	rateLimitStore, err := ratelimit.NewStore(config.RateLimit.Store, db, model.Table("rate_limits"))
+	if err != nil {
+		return err
+	}
+	proxies, err := parseTrustedProxies(config.RateLimit.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	captchaVerifier, err := captcha.New(&config.Captcha)
+	if err != nil {
+		return err
+	}
+	passwordPolicy, err := password.NewPolicy(&config.Password, &config.Hash)
+	if err != nil {
+		return err
+	}
+	hasher, err := password.NewHasher(&config.Hash)
+	if err != nil {
+		return err
+	}
+	hooks, err := hook.New(&config.Hooks, db, logger)
+	if err != nil {
+		return err
+	}
+	catalog, err := i18n.New(config.I18n.Dir, config.I18n.DefaultLocale)
+	if err != nil {
+		return err
+	}
+	emails, err := mail.NewEmailGenerator(&config.App, config.I18n.DefaultLocale)
+	if err != nil {
+		return err
+	}
+	cors, err := corsConfig(config)
+	if err != nil {
+		return err
+	}
+	cookies, err := newCookieSessions(&config.Cookie, &config.JWT)
+	if err != nil {
+		return err
+	}
 	server = echo.New()
 	server.HideBanner = true
 	server.Logger = logger
 	server.Use(middleware.Recover())
 	server.Use(middleware.Logger())
-	server.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
-	}))
+	server.Use(middleware.CORSWithConfig(cors))
 
 	h := handler{
 		db:         db,
 		config:     config,
-		emailQueue: emailQueue,
-		emails:     mail.NewEmailGenerator(&config.App),
+		emailQueue: mail.NewQueue(db, model.Table("email_queue")),
+		emails:     emails,
+		throttler:  throttle.New(throttleStore, &config.Throttle),
+		proxies:    proxies,
+		captcha:    captchaVerifier,
+		passwords:  passwordPolicy,
+		hasher:     hasher,
+		webhooks:   webhook.NewStore(db, model.Table("webhook_deliveries"), &config.Webhook),
+		hooks:      hooks,
+		catalog:    catalog,
+		cookies:    cookies,
+	}
+	server.HTTPErrorHandler = h.localizeErrors(server.DefaultHTTPErrorHandler)
+	limits, err := newRateLimiter(&config.RateLimit, rateLimitStore, h.clientIP)
+	if err != nil {
+		return err
+	}
+
+	server.POST("/signin", h.signin, limits.route("signin", false))
+	// Signing up and signing in with a provider upgrade the anonymous user of the session cookies
+	server.POST("/signup", h.signup, cookies.csrf, limits.route("signup", true))
+	server.GET("/confirm/:id", h.confirmAccount, limits.route("confirm", false))
+	server.POST("/confirm/resend", h.resendConfirmation, limits.route("resend", true))
+	server.GET("/unlock/:token", h.unlockAccount, limits.route("unlock", false))
+	server.POST("/reset", h.sendPasswordReset, limits.route("reset", true))
+	server.POST("/reset/:token", h.resetPassword, limits.route("resetPassword", false))
+	server.POST("/provider/:provider", h.signinWithProvider, cookies.csrf, limits.route("provider", false))
+	if config.Anonymous.Enabled {
+		server.POST("/signin/anonymous", h.signinAnonymous, limits.route("anonymous", false))
+	}
+	server.POST("/token/refresh", h.refreshToken, cookies.csrf, limits.route("refresh", false))
+	server.POST("/logout", h.logout, cookies.csrf, limits.route("logout", false))
+	// The revoke link is confirmed by the frontend with a POST, so email link scanners can't trigger it
+	server.POST("/revoke/:token", h.revokeSessions, limits.route("revoke", true))
+
+	// Called by the reverse proxies on every request, behind the same ip, so it isn't rate limited
+	server.GET("/verify", h.verify)
+
+	server.GET("/userinfo", h.userinfo, limits.route("userinfo", false), h.userAuth)
+	if len(config.API.IntrospectionClients) > 0 {
+		server.POST("/introspect", h.introspect, h.clientAuth)
 	}
 
-	server.POST("/signin", h.signin)
-	server.POST("/signup", h.signup)
-	server.GET("/confirm/:id", h.confirmAccount)
-	server.POST("/reset", h.sendPasswordReset)
-	server.POST("/reset/:token", h.resetPassword)
-	server.POST("/provider/:provider", h.signinWithProvider)
+	user := server.Group("/user", cookies.csrf, h.userAuth)
+	user.GET("/sessions", h.listSessions, limits.route("sessions", false))
+	user.DELETE("/sessions/:id", h.deleteSession, limits.route("sessions", false))
+
+	if config.Gateway.Upstream != "" {
+		gw, err := newGateway(&h, logger)
+		if err != nil {
+			return err
+		}
+		prefix := strings.TrimSuffix(config.Gateway.Prefix, "/")
+		server.Any(prefix, gw.serve, cookies.csrf)
+		server.Any(prefix+"/*", gw.serve, cookies.csrf)
+	}
+
+	if config.API.AdminKey != "" {
+		admin := server.Group("/admin", h.adminAuth)
+		admin.GET("/webhooks/deliveries", h.listWebhookDeliveries)
+		admin.POST("/webhooks/deliveries/:id/retry", h.retryWebhookDelivery)
+		admin.PUT("/users/:id/ban", h.banUser)
+		admin.DELETE("/users/:id/ban", h.unbanUser)
+	}
+
+	// Process the emails requested by the SQL functions
+	outboxWorker = outbox.NewWorker(db, model.Table("email_outbox"), h.processOutbox, config.Email.OutboxInterval, logger)
+	outboxWorker.Start()
+
+	// Deliver the webhooks, including the ones of the database events
+	webhookWorker = webhook.NewWorker(db, model.Table("webhook_deliveries"), &config.Webhook, logger)
+	webhookWorker.Start()
+	if len(config.Webhook.Endpoints) > 0 {
+		subscriber, err = events.NewSubscriber(config.DB.ConnectionString, config.DB.Schema, time.Minute, logger)
+		if err != nil {
+			return err
+		}
+		var relayContext context.Context
+		relayContext, stopRelay = context.WithCancel(context.Background())
+		go h.webhooks.Relay(relayContext, subscriber, model.Table("webhook_cursor"), logger)
+	}
 
 	// Run our server in a goroutine so that it doesn't block.
 	go func() {
@@ -47,9 +176,40 @@ func Run(config *config.Config, db *sql.DB, emailQueue chan mail.EmailSendReques
 			logger.Error(err)
 		}
 	}()
+	return nil
+}
+
+// corsConfig creates the CORS middleware configuration
+// The CSRF header, and the PostgREST headers when the gateway is enabled, are allowed for the browser apps
+func corsConfig(config *config.Config) (middleware.CORSConfig, error) {
+	if config.CORS.AllowCredentials {
+		for _, origin := range config.CORS.AllowOrigins {
+			if origin == "*" {
+				return middleware.CORSConfig{}, errors.New("the CORS credentials can't be allowed for all origins")
+			}
+		}
+	}
+	cors := middleware.CORSConfig{
+		AllowOrigins:     config.CORS.AllowOrigins,
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, captchaTokenHeader, config.Cookie.CSRFHeader},
+		AllowCredentials: config.CORS.AllowCredentials,
+		MaxAge:           config.CORS.MaxAge,
+	}
+	if config.Gateway.Upstream != "" {
+		cors.AllowHeaders = append(cors.AllowHeaders, config.Gateway.APIKeyHeader)
+		cors.AllowHeaders = append(cors.AllowHeaders, gatewayHeaders...)
+		cors.ExposeHeaders = gatewayExposedHeaders
+	}
+	return cors, nil
 }
 
 // Stop stops the API Server
 func Stop(ctx context.Context) {
+	outboxWorker.Stop()
+	webhookWorker.Stop()
+	if subscriber != nil {
+		stopRelay()
+		subscriber.Close()
+	}
 	server.Shutdown(ctx)
 }
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+// The context keys of the authenticated user
+const (
+	contextUserID    = "user_id"
+	contextSessionID = "session_id"
+)
+
+// issueTokens starts a session for the user, and returns its access token and refresh token
+func (h *handler) issueTokens(c echo.Context, user *model.User) (string, string, error) {
+	if err := h.checkBanned(user); err != nil {
+		return "", "", err
+	}
+	claims, err := h.hooks.PreToken(user)
+	if err != nil {
+		return "", "", hookError(err)
+	}
+	session, refreshToken, err := model.CreateSession(h.db, user.ID, c.Request().UserAgent(), h.clientIP(c))
+	if err != nil {
+		return "", "", echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your session")
+	}
+	token, err := user.CreateJWTToken(h.userRole(user), h.config.JWT.Secret, session.ID, h.config.JWT.Exp, claims)
+	if err != nil {
+		return "", "", echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your token")
+	}
+	return token, refreshToken, nil
+}
+
+// checkBanned rejects the banned users
+func (h *handler) checkBanned(user *model.User) error {
+	banned, err := user.Banned(h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while checking your account")
+	}
+	if banned {
+		return echo.NewHTTPError(http.StatusForbidden, "Your account is banned")
+	}
+	return nil
+}
+
+// userRole returns the database role of the tokens of the user
+func (h *handler) userRole(user *model.User) string {
+	if !user.Anonymous {
+		return h.config.DB.Roles.User
+	}
+	if h.config.Anonymous.Role != "" {
+		return h.config.Anonymous.Role
+	}
+	return h.config.DB.Roles.Anonymous
+}
+
+// respondWithTokens sends the tokens of a session with the body, as cookies in the cookie session mode
+// An empty refresh token isn't sent, the client keeps its current one
+func (h *handler) respondWithTokens(c echo.Context, body map[string]interface{}, token, refreshToken string) error {
+	if h.cookies.enabled {
+		body["csrf_token"] = h.cookies.set(c, token, refreshToken)
+	} else {
+		body["token"] = token
+		if refreshToken != "" {
+			body["refresh_token"] = refreshToken
+		}
+	}
+	return c.JSON(http.StatusCreated, body)
+}
+
+// requestToken returns the access token of the request, sent as bearer token or as cookie
+func (h *handler) requestToken(c echo.Context) string {
+	if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return h.cookies.token(c)
+}
+
+// requestRefreshToken returns the refresh token of the request, sent in the body or as cookie
+func (h *handler) requestRefreshToken(c echo.Context) (string, error) {
+	var req refreshRequest
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&req); err != nil {
+			return "", err
+		}
+	}
+	if req.RefreshToken == "" {
+		return h.cookies.refreshToken(c), nil
+	}
+	return req.RefreshToken, nil
+}
+
+// parseToken verifies an access token, and returns its claims
+func (h *handler) parseToken(value string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(value, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(h.config.JWT.Secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// userAuth only accepts the requests authenticated using the access token of a user, as bearer token or as cookie
+// The tokens of the anonymous users, of deleted sessions and the revoked tokens are rejected
+func (h *handler) userAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, err := h.parseToken(h.requestToken(c))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Your token is not valid")
+		}
+		userID, _ := claims["userid"].(string)
+		if userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Your token is not valid")
+		}
+		if h.anonymousToken(claims) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Please sign in")
+		}
+		if err := h.checkSession(claims); err != nil {
+			return err
+		}
+		sessionID, _ := claims["session_id"].(string)
+		c.Set(contextUserID, userID)
+		c.Set(contextSessionID, sessionID)
+		return next(c)
+	}
+}
+
+// checkSession rejects the tokens of the deleted sessions, and the tokens revoked by their user
+func (h *handler) checkSession(claims jwt.MapClaims) error {
+	active, err := h.tokenActive(claims)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while checking your session")
+	}
+	if !active {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Your session has been revoked")
+	}
+	return nil
+}
+
+// authenticate returns the claims of the credentials of the request: a bearer token, an API key or the session cookies
+// When refresh is set, an expired access token cookie is renewed using the refresh token cookie
+// The claims are nil when the request has no credentials
+func (h *handler) authenticate(c echo.Context, refresh bool) (jwt.MapClaims, error) {
+	header := c.Request().Header
+	if authorization := header.Get(echo.HeaderAuthorization); authorization != "" {
+		claims, err := h.parseToken(strings.TrimPrefix(authorization, "Bearer "))
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "Your token is not valid")
+		}
+		return claims, nil
+	}
+	if key := header.Get(h.config.Gateway.APIKeyHeader); key != "" {
+		role, ok := h.apiKeyRole(key)
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "Your API key is not valid")
+		}
+		return jwt.MapClaims{"role": role}, nil
+	}
+	if token := h.cookies.token(c); token != "" {
+		claims, err := h.parseToken(token)
+		if err == nil {
+			return claims, nil
+		}
+		if !refresh {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "Your token is not valid")
+		}
+	}
+	if refreshToken := h.cookies.refreshToken(c); refresh && refreshToken != "" {
+		token, refreshToken, err := h.refreshSession(c, refreshToken)
+		if err != nil {
+			return nil, err
+		}
+		h.cookies.set(c, token, refreshToken)
+		claims, err := h.parseToken(token)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your token")
+		}
+		return claims, nil
+	}
+	return nil, nil
+}
+
+// apiKeyRole returns the role of an API key
+func (h *handler) apiKeyRole(key string) (string, bool) {
+	for candidate, role := range h.config.Gateway.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshToken exchanges a refresh token for a new access token and refresh token
+func (h *handler) refreshToken(c echo.Context) error {
+	submitted, err := h.requestRefreshToken(c)
+	if err != nil {
+		return err
+	}
+	token, refreshToken, err := h.refreshSession(c, submitted)
+	if err != nil {
+		return err
+	}
+	return h.respondWithTokens(c, map[string]interface{}{}, token, refreshToken)
+}
+
+// refreshSession rotates a refresh token, and returns the new access token and refresh token
+// The refresh token is empty when a concurrent request has just rotated the submitted one
+// The session cookies are cleared when the refresh token is not valid
+func (h *handler) refreshSession(c echo.Context, submitted string) (string, string, error) {
+	session, refreshToken, err := model.RefreshSession(h.db, submitted, h.config.JWT.RefreshExpiry, h.config.JWT.RefreshReuseInterval)
+	if err == model.ErrInvalidRefreshToken {
+		if h.cookies.enabled {
+			h.cookies.clear(c)
+		}
+		return "", "", echo.NewHTTPError(http.StatusUnauthorized, "Your refresh token is not valid")
+	}
+	if err != nil {
+		return "", "", echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while refreshing your session")
+	}
+	var user model.User
+	user.ID = session.UserID
+	if err := user.FindByID(h.db); err != nil {
+		return "", "", echo.NewHTTPError(http.StatusNotFound, "Unable to find your account")
+	}
+	if err := h.checkBanned(&user); err != nil {
+		return "", "", err
+	}
+	claims, err := h.hooks.PreToken(&user)
+	if err != nil {
+		return "", "", hookError(err)
+	}
+	token, err := user.CreateJWTToken(h.userRole(&user), h.config.JWT.Secret, session.ID, h.config.JWT.Exp, claims)
+	if err != nil {
+		return "", "", echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while creating your token")
+	}
+	return token, refreshToken, nil
+}
+
+// logout ends the session of the refresh token, or of the access token, and clears the session cookies
+func (h *handler) logout(c echo.Context) error {
+	refreshToken, err := h.requestRefreshToken(c)
+	if err != nil {
+		return err
+	}
+	if refreshToken != "" {
+		if err := model.EndSession(h.db, refreshToken); err != nil && err != model.ErrInvalidRefreshToken {
+			return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while deleting your session")
+		}
+	} else if claims, err := h.parseToken(h.requestToken(c)); err == nil {
+		userID, _ := claims["userid"].(string)
+		sessionID, _ := claims["session_id"].(string)
+		if err := model.DeleteSession(h.db, userID, sessionID); err != nil && err != sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while deleting your session")
+		}
+	}
+	if h.cookies.enabled {
+		h.cookies.clear(c)
+	}
+	return c.JSON(http.StatusOK, map[string]bool{
+		"success": true,
+	})
+}
+
+// listSessions returns the sessions of the authenticated user
+func (h *handler) listSessions(c echo.Context) error {
+	sessions, err := model.ListSessions(h.db, c.Get(contextUserID).(string), h.config.JWT.RefreshExpiry)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while listing your sessions")
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == c.Get(contextSessionID)
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// deleteSession signs out a session of the authenticated user
+func (h *handler) deleteSession(c echo.Context) error {
+	err := model.DeleteSession(h.db, c.Get(contextUserID).(string), c.Param("id"))
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "Session not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "An error occurred while deleting your session")
+	}
+	return c.JSON(http.StatusOK, map[string]bool{
+		"success": true,
+	})
+}
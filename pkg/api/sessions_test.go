@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+)
+
+func TestParseToken(t *testing.T) {
+	h := &handler{config: &config.Config{}}
+	h.config.JWT.Secret = "secret"
+	user := model.User{ID: "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", Email: "alexandre@google.com"}
+
+	token, err := user.CreateJWTToken("user", "secret", "session", 1, map[string]interface{}{"session_id": "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := h.parseToken(token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if claims["userid"] != user.ID || claims["session_id"] != "session" {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+
+	invalid := []string{
+		"",
+		"not.a.token",
+		// Signed with another secret
+		mustToken(t, user, "other", 1),
+		// Expired
+		mustToken(t, user, "secret", -1),
+	}
+	for _, token := range invalid {
+		if _, err := h.parseToken(token); err == nil {
+			t.Errorf("Expected %q to be rejected", token)
+		}
+	}
+}
+
+func mustToken(t *testing.T, user model.User, secret string, exp int) string {
+	token, err := user.CreateJWTToken("user", secret, "session", exp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
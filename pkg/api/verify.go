@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// The response headers describing the authenticated user to the reverse proxy
+const (
+	headerAuthUserID = "X-Auth-User-Id"
+	headerAuthEmail  = "X-Auth-Email"
+	headerAuthRole   = "X-Auth-Role"
+)
+
+// verify authenticates the requests of a reverse proxy, for the nginx auth_request and Traefik ForwardAuth integrations
+// The roles query parameter restricts the accepted roles, and the redirect one sends the browsers to the login link
+// The anonymous users are only accepted with the anonymous query parameter
+func (h *handler) verify(c echo.Context) error {
+	err := h.verifyRole(c)
+	if httpErr, ok := err.(*echo.HTTPError); ok && httpErr.Code == http.StatusUnauthorized && h.redirectToLogin(c) {
+		return c.Redirect(http.StatusFound, fmt.Sprintf(h.config.Links.Login, url.QueryEscape(forwardedURL(c.Request()))))
+	}
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// verifyRole authenticates the request, checks its role and sets the headers of the authenticated user
+// The sessions aren't refreshed, the reverse proxies don't forward the cookies set by the auth responses
+func (h *handler) verifyRole(c echo.Context) error {
+	claims, err := h.authenticate(c, false)
+	if err != nil {
+		return err
+	}
+	if claims == nil || (h.anonymousToken(claims) && c.QueryParam("anonymous") != "true") {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Please sign in")
+	}
+	if err := h.checkSession(claims); err != nil {
+		return err
+	}
+	role, _ := claims["role"].(string)
+	if roles := c.QueryParam("roles"); roles != "" && !contains(strings.Split(roles, ","), role) {
+		return echo.NewHTTPError(http.StatusForbidden, "You don't have the required role")
+	}
+	userID, _ := claims["userid"].(string)
+	email, _ := claims["email"].(string)
+	header := c.Response().Header()
+	header.Set(headerAuthUserID, userID)
+	header.Set(headerAuthEmail, email)
+	header.Set(headerAuthRole, role)
+	return nil
+}
+
+// redirectToLogin checks if the unauthenticated request should be redirected to the login link
+// Only the browsers, accepting html, are redirected when the redirect mode is requested
+func (h *handler) redirectToLogin(c echo.Context) bool {
+	if h.config.Links.Login == "" || c.QueryParam("redirect") != "true" {
+		return false
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+}
+
+// forwardedURL returns the url requested to the reverse proxy, using the X-Original-URL header set in the nginx
+// configuration, or the X-Forwarded-* headers set by Traefik
+func forwardedURL(r *http.Request) string {
+	if original := r.Header.Get("X-Original-URL"); original != "" {
+		return original
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		return ""
+	}
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "https"
+	}
+	return proto + "://" + host + r.Header.Get("X-Forwarded-Uri")
+}
+
+// contains checks if the values contain the value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func TestVerify(t *testing.T) {
+	cookies, err := newCookieSessions(&config.Cookie{Enabled: true, Name: "auth", SameSite: "lax"}, &config.JWT{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handler{config: &config.Config{}, cookies: cookies, db: newFakeDB(0)}
+	h.config.JWT.Secret = "secret"
+	h.config.Links.Login = "https://app.com/login?redirect=%v"
+	h.config.Gateway.APIKeyHeader = "X-API-Key"
+	h.config.Gateway.APIKeys = map[string]string{"key": "service"}
+
+	h.config.DB.Roles.Anonymous = "anonymous"
+
+	user := model.User{ID: "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", Email: "alexandre@google.com"}
+	token, err := user.CreateJWTToken("normal_user", "secret", "", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymousToken, err := (&model.User{ID: user.ID}).CreateJWTToken("anonymous", "secret", "", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		query    string
+		headers  map[string]string
+		cookie   string
+		status   int
+		userID   string
+		role     string
+		location string
+	}{
+		{"no credentials", "", nil, "", http.StatusUnauthorized, "", "", ""},
+		{"bearer token", "", map[string]string{"Authorization": "Bearer " + token}, "", http.StatusOK, user.ID, "normal_user", ""},
+		{"cookie", "", nil, token, http.StatusOK, user.ID, "normal_user", ""},
+		{"invalid token", "", map[string]string{"Authorization": "Bearer invalid"}, "", http.StatusUnauthorized, "", "", ""},
+		{"api key", "", map[string]string{"X-API-Key": "key"}, "", http.StatusOK, "", "service", ""},
+		{"accepted role", "?roles=admin,normal_user", nil, token, http.StatusOK, user.ID, "normal_user", ""},
+		{"missing role", "?roles=admin", nil, token, http.StatusForbidden, "", "", ""},
+		{"anonymous user", "", nil, anonymousToken, http.StatusUnauthorized, "", "", ""},
+		{"accepted anonymous user", "?anonymous=true", nil, anonymousToken, http.StatusOK, user.ID, "anonymous", ""},
+		{"redirect without browser", "?redirect=true", nil, "", http.StatusUnauthorized, "", "", ""},
+		{"redirect", "?redirect=true", map[string]string{"Accept": "text/html", "X-Forwarded-Host": "grafana.app.com", "X-Forwarded-Uri": "/d/1"}, "", http.StatusFound, "", "", "https://app.com/login?redirect=https%3A%2F%2Fgrafana.app.com%2Fd%2F1"},
+	}
+
+	e := echo.New()
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/verify"+tc.query, nil)
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "auth", Value: tc.cookie})
+		}
+		rec := httptest.NewRecorder()
+		err := h.verify(e.NewContext(req, rec))
+		status := rec.Code
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			status = httpErr.Code
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if status != tc.status {
+			t.Errorf("%s: expected a %d status, got %d", tc.name, tc.status, status)
+			continue
+		}
+		if status == http.StatusOK {
+			if rec.Header().Get(headerAuthUserID) != tc.userID || rec.Header().Get(headerAuthRole) != tc.role {
+				t.Errorf("%s: unexpected headers: %v", tc.name, rec.Header())
+			}
+		}
+		if location := rec.Header().Get(echo.HeaderLocation); location != tc.location {
+			t.Errorf("%s: expected the %q location, got %q", tc.name, tc.location, location)
+		}
+	}
+}
+
+func TestVerifyExpiredCookie(t *testing.T) {
+	cookies, err := newCookieSessions(&config.Cookie{Enabled: true, Name: "auth", SameSite: "lax"}, &config.JWT{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handler{config: &config.Config{}, cookies: cookies}
+	h.config.JWT.Secret = "secret"
+	user := model.User{ID: "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", Email: "alexandre@google.com"}
+
+	req := httptest.NewRequest(http.MethodGet, "/verify", nil)
+	req.AddCookie(&http.Cookie{Name: "auth", Value: mustToken(t, user, "secret", -1)})
+	req.AddCookie(&http.Cookie{Name: "auth_refresh", Value: "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6.secret"})
+	rec := httptest.NewRecorder()
+	err = h.verify(echo.New().NewContext(req, rec))
+	if httpErr, ok := err.(*echo.HTTPError); !ok || httpErr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the expired token to be rejected, got: %v", err)
+	}
+	if cookies := rec.Header()["Set-Cookie"]; len(cookies) != 0 {
+		t.Errorf("Expected the session not to be refreshed, got: %v", cookies)
+	}
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	h := &handler{config: &config.Config{}}
+	h.config.JWT.Secret = "secret"
+	user := model.User{ID: "4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", Email: "alexandre@google.com"}
+	session := "5c1b8f4e-6a2d-4f0e-9b7a-3d2e1f0a9b8c"
+	token, err := user.CreateJWTToken("normal_user", "secret", session, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		db     *sql.DB
+		status int
+	}{
+		{"active session", newFakeDB(0, session), http.StatusOK},
+		{"deleted session", newFakeDB(0), http.StatusUnauthorized},
+		{"revoked tokens", newFakeDB(time.Now().Add(time.Minute).Unix(), session), http.StatusUnauthorized},
+	}
+	e := echo.New()
+	for _, tc := range cases {
+		h.db = tc.db
+		req := httptest.NewRequest(http.MethodGet, "/verify", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		err := h.verify(e.NewContext(req, rec))
+		status := rec.Code
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			status = httpErr.Code
+		}
+		if status != tc.status {
+			t.Errorf("%s: expected a %d status, got %d", tc.name, tc.status, status)
+		}
+	}
+}
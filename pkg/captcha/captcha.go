@@ -0,0 +1,102 @@
+package captcha
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+// Default verification urls of the supported providers
+const (
+	HCaptchaURL  = "https://hcaptcha.com/siteverify"
+	ReCaptchaURL = "https://www.google.com/recaptcha/api/siteverify"
+	TurnstileURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// ErrInvalidToken is returned when the provider rejected the captcha token
+var ErrInvalidToken = errors.New("invalid captcha token")
+
+// Verifier verifies the captcha token solved by a client
+type Verifier interface {
+	Verify(token, remoteIP string) error
+}
+
+// New creates the verifier of the configured provider
+// It returns a nil verifier when no provider is configured
+func New(config *config.Captcha) (Verifier, error) {
+	verifier := &siteVerifier{
+		url:    config.VerifyURL,
+		secret: config.Secret,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+	var defaultURL string
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case "hcaptcha":
+		defaultURL = HCaptchaURL
+	case "recaptcha":
+		defaultURL = ReCaptchaURL
+		// Only reCAPTCHA v3 responses contain a score, v2 responses are not affected
+		verifier.minScore = config.MinScore
+	case "turnstile":
+		defaultURL = TurnstileURL
+	default:
+		return nil, fmt.Errorf("unknown captcha provider: %s", config.Provider)
+	}
+	if verifier.url == "" {
+		verifier.url = defaultURL
+	}
+	return verifier, nil
+}
+
+// siteVerifier verifies tokens using the siteverify api shared by hCaptcha, reCAPTCHA and Turnstile
+type siteVerifier struct {
+	url      string
+	secret   string
+	minScore float64
+	client   *http.Client
+}
+
+// siteVerifyResponse is the response of the siteverify api
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *siteVerifier) Verify(token, remoteIP string) error {
+	if token == "" {
+		return ErrInvalidToken
+	}
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	response, err := v.client.PostForm(v.url, form)
+	if err != nil {
+		return fmt.Errorf("failed verifying captcha: %s", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed verifying captcha: unexpected status %v", response.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed reading captcha verification: %s", err.Error())
+	}
+	if !result.Success {
+		return ErrInvalidToken
+	}
+	if result.Score != nil && *result.Score < v.minScore {
+		return ErrInvalidToken
+	}
+	return nil
+}
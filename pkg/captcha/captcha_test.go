@@ -0,0 +1,70 @@
+package captcha
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+func TestVerify(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != "secret" {
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+			return
+		}
+		switch r.PostFormValue("response") {
+		case "valid":
+			w.Write([]byte(`{"success": true}`))
+		case "human":
+			w.Write([]byte(`{"success": true, "score": 0.9}`))
+		case "bot":
+			w.Write([]byte(`{"success": true, "score": 0.1}`))
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer stub.Close()
+
+	tests := []struct {
+		provider string
+		token    string
+		err      error
+	}{
+		{"hcaptcha", "valid", nil},
+		{"hcaptcha", "invalid", ErrInvalidToken},
+		{"hcaptcha", "", ErrInvalidToken},
+		{"turnstile", "valid", nil},
+		{"recaptcha", "valid", nil},
+		{"recaptcha", "human", nil},
+		{"recaptcha", "bot", ErrInvalidToken},
+	}
+	for _, test := range tests {
+		verifier, err := New(&config.Captcha{
+			Provider:  test.provider,
+			Secret:    "secret",
+			VerifyURL: stub.URL,
+			MinScore:  0.5,
+			Timeout:   time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		err = verifier.Verify(test.token, "203.0.113.1")
+		if err != test.err {
+			t.Errorf("Expected %v token %q verification to return %v, got: %v", test.provider, test.token, test.err, err)
+		}
+	}
+}
+
+func TestNewWithoutProvider(t *testing.T) {
+	verifier, err := New(&config.Captcha{})
+	if verifier != nil || err != nil {
+		t.Errorf("Expected no verifier without provider, got: %v %v", verifier, err)
+	}
+	if _, err := New(&config.Captcha{Provider: "unknown"}); err == nil {
+		t.Errorf("Expected unknown provider to return an error")
+	}
+}
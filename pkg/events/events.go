@@ -0,0 +1,131 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/lib/pq"
+)
+
+// The types of the events recorded on the users table
+const (
+	UserSignedUp      = "user.signed_up"
+	UserConfirmed     = "user.confirmed"
+	UserPasswordReset = "user.password_reset"
+	UserDeleted       = "user.deleted"
+)
+
+// batchSize is the maximum number of events loaded at once
+const batchSize = 100
+
+// Event is a change of a user, recorded in the same transaction as the change
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    string          `json:"user_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Handler processes an event, the subscription stops when it returns an error
+type Handler func(event Event) error
+
+// Subscriber delivers the events of the auth schema, in order
+type Subscriber struct {
+	db       *sql.DB
+	listener *pq.Listener
+	table    string
+	interval time.Duration
+}
+
+// NewSubscriber creates, and returns a new Subscriber listening to the events of the provided schema.
+// Events are loaded from the table when notified, and at least every interval in case a notification was missed.
+func NewSubscriber(connectionString, schema string, interval time.Duration, logger *log.Logger) (*Subscriber, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+	listener := pq.NewListener(connectionString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Errorf("An error occurred while listening to events: %v \n", err.Error())
+		}
+	})
+	if err := listener.Listen(schema + "_events"); err != nil {
+		listener.Close()
+		db.Close()
+		return nil, err
+	}
+	return &Subscriber{
+		db:       db,
+		listener: listener,
+		table:    pq.QuoteIdentifier(schema) + ".events",
+		interval: interval,
+	}, nil
+}
+
+// Subscribe calls the handler for every event recorded after the cursor (the id of the last processed event, 0 to start from the beginning)
+// It catches up on the past events first, then waits for new ones until the context is done or the handler fails.
+// Consumers should persist the id of each processed event to resume from it.
+func (s *Subscriber) Subscribe(ctx context.Context, cursor int64, handler Handler) error {
+	for {
+		var err error
+		cursor, err = s.catchUp(ctx, cursor, handler)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.listener.Notify:
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// Close stops listening and closes the connections of the subscriber
+func (s *Subscriber) Close() error {
+	if err := s.listener.Close(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// catchUp delivers the events recorded after the cursor, and returns the new cursor
+func (s *Subscriber) catchUp(ctx context.Context, cursor int64, handler Handler) (int64, error) {
+	for {
+		events, err := s.load(ctx, cursor)
+		if err != nil {
+			return cursor, err
+		}
+		for _, event := range events {
+			if err := handler(event); err != nil {
+				return cursor, err
+			}
+			cursor = event.ID
+		}
+		if len(events) < batchSize {
+			return cursor, nil
+		}
+	}
+}
+
+// load returns the next events recorded after the cursor
+func (s *Subscriber) load(ctx context.Context, cursor int64) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, type, user_id, payload, created_at FROM "+s.table+" WHERE id > $1 ORDER BY id LIMIT $2", cursor, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeEvents is a database/sql connector answering the events queries with the recorded ids
+type fakeEvents struct {
+	count int64
+	loads int
+}
+
+func (f *fakeEvents) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{f}, nil
+}
+
+func (f *fakeEvents) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	f *fakeEvents
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements aren't supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.f.loads++
+	cursor, limit := args[0].Value.(int64), args[1].Value.(int64)
+	rows := &fakeRows{}
+	for id := cursor + 1; id <= c.f.count && id <= cursor+limit; id++ {
+		rows.values = append(rows.values, []driver.Value{id, UserSignedUp, "user", []byte(`{}`), time.Now()})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "type", "user_id", "payload", "created_at"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestCatchUp(t *testing.T) {
+	events := &fakeEvents{count: 2*batchSize + 10}
+	s := &Subscriber{db: sql.OpenDB(events), table: "auth.events"}
+
+	var delivered []int64
+	cursor, err := s.catchUp(context.Background(), 5, func(event Event) error {
+		delivered = append(delivered, event.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cursor != events.count {
+		t.Errorf("Expected the cursor to be moved to the last event, got: %v", cursor)
+	}
+	if int64(len(delivered)) != events.count-5 {
+		t.Fatalf("Expected every event after the cursor to be delivered, got: %v", len(delivered))
+	}
+	for i, id := range delivered {
+		if id != int64(i+6) {
+			t.Fatalf("Expected the events to be delivered in order, got %v at %v", id, i)
+		}
+	}
+	if events.loads != 3 {
+		t.Errorf("Expected the events to be loaded in 3 batches, got: %v", events.loads)
+	}
+
+	cursor, err = s.catchUp(context.Background(), cursor, func(event Event) error {
+		return fmt.Errorf("unexpected event %v", event.ID)
+	})
+	if err != nil || cursor != events.count {
+		t.Errorf("Expected no new event, got: %v %v", cursor, err)
+	}
+}
+
+func TestCatchUpHandlerError(t *testing.T) {
+	events := &fakeEvents{count: 10}
+	s := &Subscriber{db: sql.OpenDB(events), table: "auth.events"}
+	failure := errors.New("handler failure")
+
+	cursor, err := s.catchUp(context.Background(), 0, func(event Event) error {
+		if event.ID == 4 {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Errorf("Expected the handler error, got: %v", err)
+	}
+	if cursor != 3 {
+		t.Errorf("Expected the cursor to stay on the last processed event, got: %v", cursor)
+	}
+}
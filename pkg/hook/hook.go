@@ -0,0 +1,215 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/alexandrevilain/postgrest-auth/pkg/webhook"
+	"github.com/labstack/gommon/log"
+	"github.com/lib/pq"
+)
+
+// The events calling the hooks
+const (
+	EventPreSignup = "pre_signup"
+	EventPreToken  = "pre_token"
+)
+
+// Request is the payload sent to the hooks
+type Request struct {
+	Event    string                 `json:"event"`
+	User     map[string]interface{} `json:"user"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// Response is the decision of a hook
+// Metadata replaces the user's metadata when set, Claims are added to the token
+type Response struct {
+	Reject   bool                   `json:"reject"`
+	Message  string                 `json:"message"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+// RejectedError is returned when a hook rejects the request
+type RejectedError struct {
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	if e.Message == "" {
+		return "rejected by hook"
+	}
+	return e.Message
+}
+
+// Caller calls a hook
+type Caller interface {
+	Call(ctx context.Context, request Request) (Response, error)
+}
+
+// Hooks calls the configured hooks before account creation and token issuance
+type Hooks struct {
+	preSignup Caller
+	preToken  Caller
+	timeout   time.Duration
+	failOpen  bool
+	logger    *log.Logger
+}
+
+// New creates the hooks from the configuration, unset hooks are skipped
+func New(config *config.Hooks, db *sql.DB, logger *log.Logger) (*Hooks, error) {
+	preSignup, err := newCaller(config.PreSignup, config, db)
+	if err != nil {
+		return nil, err
+	}
+	preToken, err := newCaller(config.PreToken, config, db)
+	if err != nil {
+		return nil, err
+	}
+	return &Hooks{
+		preSignup: preSignup,
+		preToken:  preToken,
+		timeout:   config.Timeout,
+		failOpen:  config.FailOpen,
+		logger:    logger,
+	}, nil
+}
+
+// newCaller creates the caller of the hook, depending on its kind
+func newCaller(target string, config *config.Hooks, db *sql.DB) (Caller, error) {
+	switch {
+	case target == "":
+		return nil, nil
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return &httpCaller{url: target, secret: config.Secret, client: &http.Client{}}, nil
+	default:
+		function, err := quoteFunction(target)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlCaller{db: db, function: function}, nil
+	}
+}
+
+// PreSignup calls the pre signup hook, which can reject the account creation or set its metadata
+func (h *Hooks) PreSignup(user *model.User) error {
+	response, err := h.call(h.preSignup, EventPreSignup, user)
+	if err != nil {
+		return err
+	}
+	if response.Metadata != nil {
+		user.Metadata = response.Metadata
+	}
+	return nil
+}
+
+// PreToken calls the pre token hook, which can reject the token issuance, and returns the claims to add to the token
+func (h *Hooks) PreToken(user *model.User) (map[string]interface{}, error) {
+	response, err := h.call(h.preToken, EventPreToken, user)
+	if err != nil {
+		return nil, err
+	}
+	return response.Claims, nil
+}
+
+// call runs the hook with the timeout, applying the failure mode when the hook can't be reached
+func (h *Hooks) call(caller Caller, event string, user *model.User) (Response, error) {
+	if caller == nil {
+		return Response{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	response, err := caller.Call(ctx, Request{
+		Event:    event,
+		User:     user.GetMapRepresentation(),
+		Metadata: user.Metadata,
+	})
+	if err != nil {
+		if h.failOpen {
+			h.logger.Warnf("The %v hook failed, ignoring it: %v", event, err.Error())
+			return Response{}, nil
+		}
+		return Response{}, fmt.Errorf("the %v hook failed: %v", event, err.Error())
+	}
+	if response.Reject {
+		return response, &RejectedError{Message: response.Message}
+	}
+	return response, nil
+}
+
+// httpCaller posts the request to an url
+type httpCaller struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (c *httpCaller) Call(ctx context.Context, request Request) (Response, error) {
+	var response Response
+	body, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hook-Signature", webhook.Sign(c.secret, body))
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return response, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return response, fmt.Errorf("unexpected status %v", res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	return response, err
+}
+
+// sqlCaller calls a postgres function taking and returning jsonb
+type sqlCaller struct {
+	db       *sql.DB
+	function string
+}
+
+func (c *sqlCaller) Call(ctx context.Context, request Request) (Response, error) {
+	var response Response
+	body, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	var result []byte
+	if err := c.db.QueryRowContext(ctx, "SELECT "+c.function+"($1::jsonb)", string(body)).Scan(&result); err != nil {
+		return response, err
+	}
+	err = json.Unmarshal(result, &response)
+	return response, err
+}
+
+// quoteFunction quotes a function name, optionally qualified by its schema
+func quoteFunction(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid hook function name: %s", name)
+	}
+	for i, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid hook function name: %s", name)
+		}
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, "."), nil
+}
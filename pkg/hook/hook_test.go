@@ -0,0 +1,82 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/labstack/gommon/log"
+)
+
+type fakeCaller struct {
+	response Response
+	err      error
+}
+
+func (c *fakeCaller) Call(ctx context.Context, request Request) (Response, error) {
+	return c.response, c.err
+}
+
+func TestQuoteFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		valid    bool
+	}{
+		{"pre_signup", `"pre_signup"`, true},
+		{"hooks.pre_signup", `"hooks"."pre_signup"`, true},
+		{`x"; DROP TABLE users; --`, `"x""; DROP TABLE users; --"`, true},
+		{"a.b.c", "", false},
+		{"hooks.", "", false},
+	}
+	for _, test := range tests {
+		got, err := quoteFunction(test.name)
+		if (err == nil) != test.valid {
+			t.Errorf("quoteFunction(%q) error = %v, expected valid: %v", test.name, err, test.valid)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("quoteFunction(%q) = %v, want %v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestPreSignup(t *testing.T) {
+	h := &Hooks{timeout: time.Second, logger: log.New("")}
+	user := &model.User{Email: "alexandre@google.com"}
+
+	if err := h.PreSignup(user); err != nil {
+		t.Errorf("Expected no error without hook, got: %v", err)
+	}
+
+	h.preSignup = &fakeCaller{response: Response{Reject: true, Message: "Invite only"}}
+	err := h.PreSignup(user)
+	if rejected, ok := err.(*RejectedError); !ok || rejected.Message != "Invite only" {
+		t.Errorf("Expected a rejection, got: %v", err)
+	}
+
+	h.preSignup = &fakeCaller{response: Response{Metadata: map[string]interface{}{"org": "google"}}}
+	if err := h.PreSignup(user); err != nil || user.Metadata["org"] != "google" {
+		t.Errorf("Expected the metadata to be set, got: %v, %v", user.Metadata, err)
+	}
+}
+
+func TestFailureMode(t *testing.T) {
+	h := &Hooks{
+		preToken: &fakeCaller{err: errors.New("timeout")},
+		timeout:  time.Second,
+		logger:   log.New(""),
+	}
+	user := &model.User{Email: "alexandre@google.com"}
+
+	if _, err := h.PreToken(user); err == nil {
+		t.Error("Expected an error when the hook fails closed")
+	}
+
+	h.failOpen = true
+	if _, err := h.PreToken(user); err != nil {
+		t.Errorf("Expected no error when the hook fails open, got: %v", err)
+	}
+}
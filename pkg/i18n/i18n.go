@@ -0,0 +1,121 @@
+package i18n
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Catalog translates the messages of the API, using the english message as key
+type Catalog struct {
+	defaultLocale string
+	messages      map[string]map[string]string
+}
+
+// New creates a Catalog with the built-in translations and the ones of the <locale>.json files of the directory
+// Translations loaded from the directory are added to the built-in ones, and replace them when both define a message
+func New(dir, defaultLocale string) (*Catalog, error) {
+	c := &Catalog{
+		defaultLocale: Normalize(defaultLocale),
+		messages:      map[string]map[string]string{"en": {}},
+	}
+	for locale, messages := range builtinMessages {
+		c.add(locale, messages)
+	}
+	if dir == "" {
+		return c, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(content, &messages); err != nil {
+			return nil, err
+		}
+		c.add(strings.TrimSuffix(filepath.Base(file), ".json"), messages)
+	}
+	return c, nil
+}
+
+func (c *Catalog) add(locale string, messages map[string]string) {
+	locale = Normalize(locale)
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string)
+	}
+	for message, translation := range messages {
+		c.messages[locale][message] = translation
+	}
+}
+
+// Default returns the locale used when no supported locale is requested
+func (c *Catalog) Default() string {
+	return c.defaultLocale
+}
+
+// Locales returns the supported locales
+func (c *Catalog) Locales() []string {
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported returns the supported locale matching the provided one, falling back on its language ("fr-ca" matches "fr")
+// It returns an empty string when the locale isn't supported
+func (c *Catalog) Supported(locale string) string {
+	locale = Normalize(locale)
+	if _, ok := c.messages[locale]; ok {
+		return locale
+	}
+	if i := strings.Index(locale, "-"); i > 0 {
+		if _, ok := c.messages[locale[:i]]; ok {
+			return locale[:i]
+		}
+	}
+	return ""
+}
+
+// Match returns the preferred supported locale of an Accept-Language header, or the default locale
+func (c *Catalog) Match(acceptLanguage string) string {
+	best, bestQuality := c.defaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if locale := c.Supported(fields[0]); locale != "" && quality > bestQuality {
+			best, bestQuality = locale, quality
+		}
+	}
+	return best
+}
+
+// Translate returns the message in the locale, or the message itself when it isn't translated
+func (c *Catalog) Translate(locale, message string) string {
+	if translation, ok := c.messages[c.Supported(locale)][message]; ok {
+		return translation
+	}
+	return message
+}
+
+// Normalize lowercases the locale and uses dashes as separator ("fr_FR" becomes "fr-fr")
+func Normalize(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
@@ -0,0 +1,62 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	catalog, err := New("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		acceptLanguage string
+		locale         string
+	}{
+		{"", "en"},
+		{"fr-FR,fr;q=0.9,en;q=0.8", "fr"},
+		{"ja,de;q=0.5", "de"},
+		{"en;q=0.4,es;q=0.7", "es"},
+		{"ja", "en"},
+	}
+	for _, test := range tests {
+		if got := catalog.Match(test.acceptLanguage); got != test.locale {
+			t.Errorf("Match(%q) = %v, want %v", test.acceptLanguage, got, test.locale)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	messages := `{ "Please confirm your account": "Conferma il tuo account" }`
+	if err := ioutil.WriteFile(filepath.Join(dir, "it.json"), []byte(messages), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := New(dir, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		locale      string
+		message     string
+		translation string
+	}{
+		{"fr", "Please confirm your account", "Veuillez confirmer votre compte"},
+		{"it-IT", "Please confirm your account", "Conferma il tuo account"},
+		{"en", "Please confirm your account", "Please confirm your account"},
+		{"fr", "Not translated", "Not translated"},
+	}
+	for _, test := range tests {
+		if got := catalog.Translate(test.locale, test.message); got != test.translation {
+			t.Errorf("Translate(%q, %q) = %v, want %v", test.locale, test.message, got, test.translation)
+		}
+	}
+}
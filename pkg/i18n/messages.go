@@ -0,0 +1,140 @@
+package i18n
+
+// builtinMessages are the translations of the API messages shipped with the service
+var builtinMessages = map[string]map[string]string{
+	"fr": {
+		"An error occurred while checking the token":                             "Une erreur est survenue lors de la vérification du jeton",
+		"An error occurred while checking your account":                          "Une erreur est survenue lors de la vérification de votre compte",
+		"An error occurred while checking your password":                         "Une erreur est survenue lors de la vérification de votre mot de passe",
+		"An error occurred while checking your request, please retry later":      "Une erreur est survenue lors de la vérification de votre demande, veuillez réessayer plus tard",
+		"An error occurred while checking your session":                          "Une erreur est survenue lors de la vérification de votre session",
+		"An error occurred while checking your sign in attempts":                 "Une erreur est survenue lors de la vérification de vos tentatives de connexion",
+		"An error occurred while creating your account":                          "Une erreur est survenue lors de la création de votre compte",
+		"An error occurred while creating your reset password":                   "Une erreur est survenue lors de la réinitialisation de votre mot de passe",
+		"An error occurred while creating your session":                          "Une erreur est survenue lors de la création de votre session",
+		"An error occurred while creating your token":                            "Une erreur est survenue lors de la création de votre jeton",
+		"An error occurred while deleting your session":                          "Une erreur est survenue lors de la suppression de votre session",
+		"An error occurred while hashing your password":                          "Une erreur est survenue lors du chiffrement de votre mot de passe",
+		"An error occurred while listing your sessions":                          "Une erreur est survenue lors de la récupération de vos sessions",
+		"An error occurred while refreshing your session":                        "Une erreur est survenue lors du renouvellement de votre session",
+		"An error occurred while revoking your sessions":                         "Une erreur est survenue lors de la révocation de vos sessions",
+		"An error occurred while unlocking your account":                         "Une erreur est survenue lors du déverrouillage de votre compte",
+		"An error occurred while updating your email confirmation":               "Une erreur est survenue lors de la confirmation de votre adresse email",
+		"An error occurred while updating your password":                         "Une erreur est survenue lors de la mise à jour de votre mot de passe",
+		"An error occurred while verifying the captcha":                          "Une erreur est survenue lors de la vérification du captcha",
+		"An error occurred with your payload":                                    "Une erreur est survenue avec votre requête",
+		"Invalid client credentials":                                             "Identifiants client invalides",
+		"Please confirm your account":                                            "Veuillez confirmer votre compte",
+		"Please sign in":                                                         "Veuillez vous connecter",
+		"Session not found":                                                      "Session introuvable",
+		"The captcha verification failed":                                        "La vérification du captcha a échoué",
+		"The token parameter is required":                                        "Le paramètre token est obligatoire",
+		"Too many failed attempts, please try again later":                       "Trop de tentatives échouées, veuillez réessayer plus tard",
+		"Too many requests, please try again later":                              "Trop de requêtes, veuillez réessayer plus tard",
+		"Unable to find your account":                                            "Impossible de trouver votre compte",
+		"Wrong reset token":                                                      "Jeton de réinitialisation invalide",
+		"You're not allowed to create an account with the provied email address": "Vous n'êtes pas autorisé à créer un compte avec cette adresse email",
+		"You don't have the required role":                                       "Vous n'avez pas le rôle requis",
+		"Your API key is not valid":                                              "Votre clé d'API n'est pas valide",
+		"Your CSRF token is not valid":                                           "Votre jeton CSRF n'est pas valide",
+		"Your account is banned":                                                 "Votre compte est banni",
+		"Your email confirmation token has expired, please ask for a new one":    "Votre jeton de confirmation a expiré, veuillez en demander un nouveau",
+		"Your email confirmation token is not valid":                             "Votre jeton de confirmation n'est pas valide",
+		"Your password doesn't match the password policy":                        "Votre mot de passe ne respecte pas la politique de mots de passe",
+		"Your refresh token is not valid":                                        "Votre jeton de renouvellement n'est pas valide",
+		"Your revoke token is not valid":                                         "Votre jeton de révocation n'est pas valide",
+		"Your session has been revoked":                                          "Votre session a été révoquée",
+		"Your token is not valid":                                                "Votre jeton n'est pas valide",
+		"Your unlock token is not valid":                                         "Votre jeton de déverrouillage n'est pas valide",
+	},
+	"de": {
+		"An error occurred while checking the token":                             "Beim Überprüfen des Tokens ist ein Fehler aufgetreten",
+		"An error occurred while checking your account":                          "Beim Überprüfen Ihres Kontos ist ein Fehler aufgetreten",
+		"An error occurred while checking your password":                         "Beim Überprüfen Ihres Passworts ist ein Fehler aufgetreten",
+		"An error occurred while checking your request, please retry later":      "Beim Überprüfen Ihrer Anfrage ist ein Fehler aufgetreten, bitte versuchen Sie es später erneut",
+		"An error occurred while checking your session":                          "Beim Überprüfen Ihrer Sitzung ist ein Fehler aufgetreten",
+		"An error occurred while checking your sign in attempts":                 "Beim Überprüfen Ihrer Anmeldeversuche ist ein Fehler aufgetreten",
+		"An error occurred while creating your account":                          "Beim Erstellen Ihres Kontos ist ein Fehler aufgetreten",
+		"An error occurred while creating your reset password":                   "Beim Zurücksetzen Ihres Passworts ist ein Fehler aufgetreten",
+		"An error occurred while creating your session":                          "Beim Erstellen Ihrer Sitzung ist ein Fehler aufgetreten",
+		"An error occurred while creating your token":                            "Beim Erstellen Ihres Tokens ist ein Fehler aufgetreten",
+		"An error occurred while deleting your session":                          "Beim Löschen Ihrer Sitzung ist ein Fehler aufgetreten",
+		"An error occurred while hashing your password":                          "Beim Verschlüsseln Ihres Passworts ist ein Fehler aufgetreten",
+		"An error occurred while listing your sessions":                          "Beim Abrufen Ihrer Sitzungen ist ein Fehler aufgetreten",
+		"An error occurred while refreshing your session":                        "Beim Erneuern Ihrer Sitzung ist ein Fehler aufgetreten",
+		"An error occurred while revoking your sessions":                         "Beim Widerrufen Ihrer Sitzungen ist ein Fehler aufgetreten",
+		"An error occurred while unlocking your account":                         "Beim Entsperren Ihres Kontos ist ein Fehler aufgetreten",
+		"An error occurred while updating your email confirmation":               "Beim Bestätigen Ihrer E-Mail-Adresse ist ein Fehler aufgetreten",
+		"An error occurred while updating your password":                         "Beim Aktualisieren Ihres Passworts ist ein Fehler aufgetreten",
+		"An error occurred while verifying the captcha":                          "Beim Überprüfen des Captchas ist ein Fehler aufgetreten",
+		"An error occurred with your payload":                                    "Ihre Anfrage ist fehlerhaft",
+		"Invalid client credentials":                                             "Ungültige Client-Anmeldedaten",
+		"Please confirm your account":                                            "Bitte bestätigen Sie Ihr Konto",
+		"Please sign in":                                                         "Bitte melden Sie sich an",
+		"Session not found":                                                      "Sitzung nicht gefunden",
+		"The captcha verification failed":                                        "Die Captcha-Überprüfung ist fehlgeschlagen",
+		"The token parameter is required":                                        "Der Parameter token ist erforderlich",
+		"Too many failed attempts, please try again later":                       "Zu viele fehlgeschlagene Versuche, bitte versuchen Sie es später erneut",
+		"Too many requests, please try again later":                              "Zu viele Anfragen, bitte versuchen Sie es später erneut",
+		"Unable to find your account":                                            "Ihr Konto wurde nicht gefunden",
+		"Wrong reset token":                                                      "Ungültiger Token zum Zurücksetzen",
+		"You're not allowed to create an account with the provied email address": "Mit dieser E-Mail-Adresse dürfen Sie kein Konto erstellen",
+		"You don't have the required role":                                       "Sie haben nicht die erforderliche Rolle",
+		"Your API key is not valid":                                              "Ihr API-Schlüssel ist ungültig",
+		"Your CSRF token is not valid":                                           "Ihr CSRF-Token ist ungültig",
+		"Your account is banned":                                                 "Ihr Konto ist gesperrt",
+		"Your email confirmation token has expired, please ask for a new one":    "Ihr Bestätigungstoken ist abgelaufen, bitte fordern Sie ein neues an",
+		"Your email confirmation token is not valid":                             "Ihr Bestätigungstoken ist ungültig",
+		"Your password doesn't match the password policy":                        "Ihr Passwort entspricht nicht der Passwortrichtlinie",
+		"Your refresh token is not valid":                                        "Ihr Erneuerungstoken ist ungültig",
+		"Your revoke token is not valid":                                         "Ihr Widerrufstoken ist ungültig",
+		"Your session has been revoked":                                          "Ihre Sitzung wurde widerrufen",
+		"Your token is not valid":                                                "Ihr Token ist ungültig",
+		"Your unlock token is not valid":                                         "Ihr Entsperrtoken ist ungültig",
+	},
+	"es": {
+		"An error occurred while checking the token":                             "Se produjo un error al verificar el token",
+		"An error occurred while checking your account":                          "Se produjo un error al verificar tu cuenta",
+		"An error occurred while checking your password":                         "Se produjo un error al verificar tu contraseña",
+		"An error occurred while checking your request, please retry later":      "Se produjo un error al verificar tu solicitud, vuelve a intentarlo más tarde",
+		"An error occurred while checking your session":                          "Se produjo un error al verificar tu sesión",
+		"An error occurred while checking your sign in attempts":                 "Se produjo un error al verificar tus intentos de inicio de sesión",
+		"An error occurred while creating your account":                          "Se produjo un error al crear tu cuenta",
+		"An error occurred while creating your reset password":                   "Se produjo un error al restablecer tu contraseña",
+		"An error occurred while creating your session":                          "Se produjo un error al crear tu sesión",
+		"An error occurred while creating your token":                            "Se produjo un error al crear tu token",
+		"An error occurred while deleting your session":                          "Se produjo un error al eliminar tu sesión",
+		"An error occurred while hashing your password":                          "Se produjo un error al cifrar tu contraseña",
+		"An error occurred while listing your sessions":                          "Se produjo un error al obtener tus sesiones",
+		"An error occurred while refreshing your session":                        "Se produjo un error al renovar tu sesión",
+		"An error occurred while revoking your sessions":                         "Se produjo un error al revocar tus sesiones",
+		"An error occurred while unlocking your account":                         "Se produjo un error al desbloquear tu cuenta",
+		"An error occurred while updating your email confirmation":               "Se produjo un error al confirmar tu correo electrónico",
+		"An error occurred while updating your password":                         "Se produjo un error al actualizar tu contraseña",
+		"An error occurred while verifying the captcha":                          "Se produjo un error al verificar el captcha",
+		"An error occurred with your payload":                                    "Tu solicitud no es válida",
+		"Invalid client credentials":                                             "Credenciales de cliente no válidas",
+		"Please confirm your account":                                            "Por favor, confirma tu cuenta",
+		"Please sign in":                                                         "Inicia sesión",
+		"Session not found":                                                      "Sesión no encontrada",
+		"The captcha verification failed":                                        "La verificación del captcha ha fallado",
+		"The token parameter is required":                                        "El parámetro token es obligatorio",
+		"Too many failed attempts, please try again later":                       "Demasiados intentos fallidos, vuelve a intentarlo más tarde",
+		"Too many requests, please try again later":                              "Demasiadas solicitudes, vuelve a intentarlo más tarde",
+		"Unable to find your account":                                            "No se encontró tu cuenta",
+		"Wrong reset token":                                                      "Token de restablecimiento no válido",
+		"You're not allowed to create an account with the provied email address": "No puedes crear una cuenta con esta dirección de correo electrónico",
+		"You don't have the required role":                                       "No tienes el rol requerido",
+		"Your API key is not valid":                                              "Tu clave de API no es válida",
+		"Your CSRF token is not valid":                                           "Tu token CSRF no es válido",
+		"Your account is banned":                                                 "Tu cuenta está bloqueada",
+		"Your email confirmation token has expired, please ask for a new one":    "Tu token de confirmación ha caducado, solicita uno nuevo",
+		"Your email confirmation token is not valid":                             "Tu token de confirmación no es válido",
+		"Your password doesn't match the password policy":                        "Tu contraseña no cumple la política de contraseñas",
+		"Your refresh token is not valid":                                        "Tu token de renovación no es válido",
+		"Your revoke token is not valid":                                         "Tu token de revocación no es válido",
+		"Your session has been revoked":                                          "Tu sesión ha sido revocada",
+		"Your token is not valid":                                                "Tu token no es válido",
+		"Your unlock token is not valid":                                         "Tu token de desbloqueo no es válido",
+	},
+}
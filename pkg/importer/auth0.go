@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+)
+
+// auth0User is a line of an Auth0 users export (NDJSON), including the password hashes export fields
+type auth0User struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	PasswordHash  string `json:"passwordHash"`
+	Identities    []struct {
+		Provider string      `json:"provider"`
+		UserID   interface{} `json:"user_id"`
+	} `json:"identities"`
+}
+
+func readAuth0(r io.Reader) ([]Record, []*RowError, error) {
+	var records []Record
+	var errors []*RowError
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var user auth0User
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			errors = append(errors, &RowError{Row: row, Err: err})
+			continue
+		}
+		record := Record{
+			Row:       row,
+			Email:     user.Email,
+			Password:  user.PasswordHash,
+			Confirmed: user.EmailVerified,
+		}
+		for _, identity := range user.Identities {
+			if isPasswordProvider(identity.Provider) {
+				continue
+			}
+			record.Identities = append(record.Identities, model.Identity{
+				Provider: providerName(identity.Provider),
+				Subject:  toString(identity.UserID),
+			})
+		}
+		records = append(records, record)
+	}
+	return records, errors, scanner.Err()
+}
+
+// toString converts json ids, which can be numbers or strings, to strings
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return ""
+}
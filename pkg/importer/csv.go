@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+)
+
+// readCSV reads a csv file with a header row
+// The email column is required, id, password_hash, confirmed, provider and provider_id are optional
+func readCSV(r io.Reader) ([]Record, []*RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading csv header: %s", err.Error())
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, nil, fmt.Errorf("missing email column in csv header")
+	}
+
+	var records []Record
+	var errors []*RowError
+	row := 1
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			errors = append(errors, &RowError{Row: row, Err: err})
+			continue
+		}
+		value := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+		record := Record{
+			Row:      row,
+			ID:       value("id"),
+			Email:    value("email"),
+			Password: value("password_hash"),
+		}
+		if confirmed := value("confirmed"); confirmed != "" {
+			record.Confirmed, err = strconv.ParseBool(confirmed)
+			if err != nil {
+				errors = append(errors, &RowError{Row: row, Email: record.Email, Err: fmt.Errorf("invalid confirmed value: %s", confirmed)})
+				continue
+			}
+		}
+		if provider := value("provider"); !isPasswordProvider(provider) {
+			record.Identities = []model.Identity{{Provider: providerName(provider), Subject: value("provider_id")}}
+		}
+		records = append(records, record)
+	}
+	return records, errors, nil
+}
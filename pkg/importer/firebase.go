@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/alexandrevilain/postgrest-auth/pkg/password"
+)
+
+// firebaseExport is the output of `firebase auth:export --format=json`
+type firebaseExport struct {
+	Users []struct {
+		LocalID          string `json:"localId"`
+		Email            string `json:"email"`
+		EmailVerified    bool   `json:"emailVerified"`
+		PasswordHash     string `json:"passwordHash"`
+		Salt             string `json:"salt"`
+		ProviderUserInfo []struct {
+			ProviderID string `json:"providerId"`
+			RawID      string `json:"rawId"`
+		} `json:"providerUserInfo"`
+	} `json:"users"`
+}
+
+func readFirebase(r io.Reader, options *Options) ([]Record, []*RowError, error) {
+	var export firebaseExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, fmt.Errorf("failed reading firebase export: %s", err.Error())
+	}
+	var records []Record
+	var errors []*RowError
+	for i, user := range export.Users {
+		record := Record{
+			Row:       i + 1,
+			ID:        user.LocalID,
+			Email:     user.Email,
+			Confirmed: user.EmailVerified,
+		}
+		if user.PasswordHash != "" {
+			if options.FirebaseSignerKey == "" {
+				return nil, nil, fmt.Errorf("the firebase hash parameters are required to import passwords")
+			}
+			hash, err := password.FirebaseScryptHash(options.FirebaseSignerKey, options.FirebaseSaltSeparator, options.FirebaseRounds, options.FirebaseMemCost, user.Salt, user.PasswordHash)
+			if err != nil {
+				errors = append(errors, &RowError{Row: record.Row, Email: user.Email, Err: err})
+				continue
+			}
+			record.Password = hash
+		}
+		for _, info := range user.ProviderUserInfo {
+			if isPasswordProvider(info.ProviderID) {
+				continue
+			}
+			record.Identities = append(record.Identities, model.Identity{
+				Provider: providerName(info.ProviderID),
+				Subject:  info.RawID,
+			})
+		}
+		records = append(records, record)
+	}
+	return records, errors, nil
+}
@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+	"github.com/alexandrevilain/postgrest-auth/pkg/password"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Record is a user read from an export
+type Record struct {
+	// Row is the position of the user in the export, used in error reports
+	Row        int
+	ID         string
+	Email      string
+	Password   string
+	Confirmed  bool
+	Identities []model.Identity
+}
+
+// RowError is the error of a single user of the export
+type RowError struct {
+	Row   int
+	Email string
+	Err   error
+}
+
+func (e *RowError) Error() string {
+	if e.Email == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Err.Error())
+	}
+	return fmt.Sprintf("row %d (%s): %s", e.Row, e.Email, e.Err.Error())
+}
+
+// Options are the format-specific import options
+type Options struct {
+	// Firebase hash parameters, as shown in the Firebase console
+	FirebaseSignerKey     string
+	FirebaseSaltSeparator string
+	FirebaseRounds        int
+	FirebaseMemCost       int
+}
+
+// Read reads the users of an export in the provided format: auth0, firebase, supabase or csv
+// Users which can't be read are reported as row errors
+func Read(format string, r io.Reader, options *Options) ([]Record, []*RowError, error) {
+	switch format {
+	case "auth0":
+		return readAuth0(r)
+	case "firebase":
+		return readFirebase(r, options)
+	case "supabase":
+		return readSupabase(r)
+	case "csv":
+		return readCSV(r)
+	default:
+		return nil, nil, fmt.Errorf("unknown import format: %s", format)
+	}
+}
+
+// Import inserts the records in the database, and returns the number of imported users
+// When dryRun is true, every insert is rolled back so only the errors are reported
+func Import(db *sql.DB, records []Record, dryRun bool) (int, []*RowError) {
+	var errors []*RowError
+	imported := 0
+	for _, record := range records {
+		if err := validate(&record); err != nil {
+			errors = append(errors, &RowError{Row: record.Row, Email: record.Email, Err: err})
+			continue
+		}
+		user := model.User{
+			ID:        record.ID,
+			Email:     record.Email,
+			Password:  record.Password,
+			Confirmed: record.Confirmed,
+		}
+		if err := user.Import(db, record.Identities, dryRun); err != nil {
+			errors = append(errors, &RowError{Row: record.Row, Email: record.Email, Err: err})
+			continue
+		}
+		imported++
+	}
+	return imported, errors
+}
+
+// validate checks that the record can be inserted
+// Ids which are not uuids are dropped, a new one is generated on insert
+func validate(record *Record) error {
+	if record.Email == "" {
+		return fmt.Errorf("missing email address")
+	}
+	if record.Password != "" && !password.Supported(record.Password) {
+		return fmt.Errorf("unsupported password hash format")
+	}
+	if _, err := uuid.FromString(record.ID); err != nil {
+		record.ID = ""
+	}
+	return nil
+}
+
+// providerName normalizes the provider names used by other auth systems
+func providerName(name string) string {
+	name = strings.ToLower(name)
+	switch name {
+	case "google-oauth2", "google.com":
+		return "google"
+	case "facebook.com":
+		return "facebook"
+	}
+	return name
+}
+
+// isPasswordProvider checks if the provider name refers to the email/password authentication
+func isPasswordProvider(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "auth0", "password", "email":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		format  string
+		input   string
+		records []Record
+		errors  int
+	}{
+		{
+			"auth0",
+			`{"_id":{"$oid":"5b1e3f5c"},"email":"alexandre@google.com","email_verified":true,"passwordHash":"$2b$10$Ws8Lr1Rvz6Cw2kTUSqLh7O"}
+			not json
+			{"email":"john@google.com","identities":[{"provider":"google-oauth2","user_id":"1234"}]}`,
+			[]Record{
+				{Row: 1, Email: "alexandre@google.com", Password: "$2b$10$Ws8Lr1Rvz6Cw2kTUSqLh7O", Confirmed: true},
+				{Row: 3, Email: "john@google.com", Identities: []model.Identity{{Provider: "google", Subject: "1234"}}},
+			},
+			1,
+		},
+		{
+			"supabase",
+			`[{"id":"c9a3d6a3-4f52-4d7c-9d4b-1f6a0e8e3c1a","email":"alexandre@google.com","encrypted_password":"$2a$10$abc","email_confirmed_at":"2021-01-01T00:00:00Z","identities":[{"provider":"email","id":"c9a3d6a3"},{"provider":"github","id":"42"}]}]`,
+			[]Record{
+				{Row: 1, ID: "c9a3d6a3-4f52-4d7c-9d4b-1f6a0e8e3c1a", Email: "alexandre@google.com", Password: "$2a$10$abc", Confirmed: true, Identities: []model.Identity{{Provider: "github", Subject: "42"}}},
+			},
+			0,
+		},
+		{
+			"csv",
+			"email,password_hash,confirmed,provider,provider_id\nalexandre@google.com,$2a$10$abc,true,,\njohn@google.com,,maybe,,\njane@google.com,,false,facebook.com,99\n",
+			[]Record{
+				{Row: 2, Email: "alexandre@google.com", Password: "$2a$10$abc", Confirmed: true},
+				{Row: 4, Email: "jane@google.com", Identities: []model.Identity{{Provider: "facebook", Subject: "99"}}},
+			},
+			1,
+		},
+	}
+	for _, test := range tests {
+		records, errors, err := Read(test.format, strings.NewReader(test.input), &Options{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(records, test.records) {
+			t.Errorf("Expected %v records to be %+v, got: %+v", test.format, test.records, records)
+		}
+		if len(errors) != test.errors {
+			t.Errorf("Expected %v row errors in %v export, got: %v", test.errors, test.format, errors)
+		}
+	}
+}
+
+func TestReadFirebase(t *testing.T) {
+	input := `{"users":[{"localId":"abc","email":"alexandre@google.com","emailVerified":true,"passwordHash":"lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ==","salt":"42xEC+ixf3L2lw==","providerUserInfo":[{"providerId":"google.com","rawId":"1234"}]}]}`
+	if _, _, err := Read("firebase", strings.NewReader(input), &Options{}); err == nil {
+		t.Errorf("Expected missing firebase hash parameters to return an error")
+	}
+	records, errors, err := Read("firebase", strings.NewReader(input), &Options{
+		FirebaseSignerKey:     "jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA==",
+		FirebaseSaltSeparator: "Bw==",
+		FirebaseRounds:        8,
+		FirebaseMemCost:       14,
+	})
+	if err != nil || len(errors) != 0 || len(records) != 1 {
+		t.Fatalf("Expected one record, got: %v %v %v", records, errors, err)
+	}
+	if !strings.HasPrefix(records[0].Password, "$firebase-scrypt$r=8,m=14$") {
+		t.Errorf("Expected firebase hash to be encoded, got: %v", records[0].Password)
+	}
+	if !reflect.DeepEqual(records[0].Identities, []model.Identity{{Provider: "google", Subject: "1234"}}) {
+		t.Errorf("Expected google identity, got: %v", records[0].Identities)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	record := Record{ID: "5b1e3f5c", Email: "alexandre@google.com", Password: "plaintext"}
+	if err := validate(&record); err == nil {
+		t.Errorf("Expected unsupported hash to be rejected")
+	}
+	record.Password = "$2a$10$abc"
+	if err := validate(&record); err != nil || record.ID != "" {
+		t.Errorf("Expected record to be valid without its id, got: %v %v", err, record.ID)
+	}
+}
@@ -0,0 +1,60 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/model"
+)
+
+// supabaseUser is a row of the Supabase/GoTrue auth.users table, exported as a json array with:
+//
+//	SELECT json_agg(u) FROM (
+//	  SELECT users.*, (SELECT json_agg(i) FROM auth.identities i WHERE i.user_id = users.id) AS identities
+//	  FROM auth.users
+//	) u;
+type supabaseUser struct {
+	ID                string  `json:"id"`
+	Email             string  `json:"email"`
+	EncryptedPassword string  `json:"encrypted_password"`
+	EmailConfirmedAt  *string `json:"email_confirmed_at"`
+	Identities        []struct {
+		Provider   string `json:"provider"`
+		ID         string `json:"id"`
+		ProviderID string `json:"provider_id"`
+	} `json:"identities"`
+}
+
+func readSupabase(r io.Reader) ([]Record, []*RowError, error) {
+	var users []supabaseUser
+	if err := json.NewDecoder(r).Decode(&users); err != nil {
+		return nil, nil, fmt.Errorf("failed reading supabase export: %s", err.Error())
+	}
+	var records []Record
+	for i, user := range users {
+		record := Record{
+			Row:       i + 1,
+			ID:        user.ID,
+			Email:     user.Email,
+			Password:  user.EncryptedPassword,
+			Confirmed: user.EmailConfirmedAt != nil,
+		}
+		for _, identity := range user.Identities {
+			if isPasswordProvider(identity.Provider) {
+				continue
+			}
+			// Recent GoTrue versions store the provider's user id in provider_id, older ones in id
+			subject := identity.ProviderID
+			if subject == "" {
+				subject = identity.ID
+			}
+			record.Identities = append(record.Identities, model.Identity{
+				Provider: providerName(identity.Provider),
+				Subject:  subject,
+			})
+		}
+		records = append(records, record)
+	}
+	return records, nil, nil
+}
@@ -0,0 +1,263 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+// The default base urls of the email APIs, overridable to use a local stub
+var defaultBaseURLs = map[string]string{
+	"sendgrid": "https://api.sendgrid.com",
+	"mailgun":  "https://api.mailgun.net",
+	"postmark": "https://api.postmarkapp.com",
+}
+
+// apiTransport sends the emails using the http API of an email provider
+type apiTransport struct {
+	provider string
+	baseURL  string
+	key      string
+	secret   string
+	domain   string
+	region   string
+	client   *http.Client
+}
+
+func newAPITransport(config *config.Email) (*apiTransport, error) {
+	t := &apiTransport{
+		provider: config.Transport,
+		baseURL:  strings.TrimSuffix(config.API.BaseURL, "/"),
+		key:      config.API.Key,
+		secret:   config.API.Secret,
+		domain:   config.API.Domain,
+		region:   config.API.Region,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if t.baseURL == "" {
+		t.baseURL = defaultBaseURLs[t.provider]
+		if t.provider == "ses" {
+			t.baseURL = "https://email." + t.region + ".amazonaws.com"
+		}
+	}
+	if t.key == "" {
+		return nil, fmt.Errorf("the %s transport requires an api key", t.provider)
+	}
+	if t.provider == "mailgun" && t.domain == "" {
+		return nil, fmt.Errorf("the mailgun transport requires a domain")
+	}
+	if t.provider == "ses" && t.secret == "" {
+		return nil, fmt.Errorf("the ses transport requires a secret key")
+	}
+	return t, nil
+}
+
+func (t *apiTransport) Send(message Message) error {
+	req, err := t.newRequest(message)
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<12))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s answered with status %v: %s", t.provider, res.StatusCode, body)
+	}
+	return nil
+}
+
+// newRequest creates the request sending the message, in the format of the provider
+func (t *apiTransport) newRequest(message Message) (*http.Request, error) {
+	switch t.provider {
+	case "sendgrid":
+		from := map[string]string{"email": message.From}
+		if message.FromName != "" {
+			from["name"] = message.FromName
+		}
+		// The plain text part must come first
+		var content []interface{}
+		if message.Text != "" {
+			content = append(content, map[string]string{"type": "text/plain", "value": message.Text})
+		}
+		content = append(content, map[string]string{"type": "text/html", "value": message.HTML})
+		payload := map[string]interface{}{
+			"personalizations": []interface{}{map[string]interface{}{
+				"to": []interface{}{map[string]string{"email": message.To}},
+			}},
+			"from":    from,
+			"subject": message.Subject,
+			"content": content,
+		}
+		if message.ReplyTo != "" {
+			payload["reply_to"] = map[string]string{"email": message.ReplyTo}
+		}
+		if message.ListUnsubscribe != "" {
+			payload["headers"] = map[string]string{"List-Unsubscribe": message.ListUnsubscribe}
+		}
+		req, err := newJSONRequest(t.baseURL+"/v3/mail/send", payload)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+t.key)
+		return req, nil
+	case "mailgun":
+		form := url.Values{}
+		form.Set("from", message.from())
+		form.Set("to", message.To)
+		form.Set("subject", message.Subject)
+		form.Set("html", message.HTML)
+		if message.Text != "" {
+			form.Set("text", message.Text)
+		}
+		if message.ReplyTo != "" {
+			form.Set("h:Reply-To", message.ReplyTo)
+		}
+		if message.ListUnsubscribe != "" {
+			form.Set("h:List-Unsubscribe", message.ListUnsubscribe)
+		}
+		req, err := http.NewRequest(http.MethodPost, t.baseURL+"/v3/"+t.domain+"/messages", strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("api", t.key)
+		return req, nil
+	case "postmark":
+		payload := map[string]interface{}{
+			"From":     message.from(),
+			"To":       message.To,
+			"Subject":  message.Subject,
+			"HtmlBody": message.HTML,
+		}
+		if message.Text != "" {
+			payload["TextBody"] = message.Text
+		}
+		if message.ReplyTo != "" {
+			payload["ReplyTo"] = message.ReplyTo
+		}
+		if message.ListUnsubscribe != "" {
+			payload["Headers"] = []interface{}{map[string]string{"Name": "List-Unsubscribe", "Value": message.ListUnsubscribe}}
+		}
+		req, err := newJSONRequest(t.baseURL+"/email", payload)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Postmark-Server-Token", t.key)
+		return req, nil
+	default:
+		simple := map[string]interface{}{
+			"Subject": map[string]string{"Data": message.Subject},
+			"Body":    map[string]interface{}{"Html": map[string]string{"Data": message.HTML}},
+		}
+		if message.Text != "" {
+			simple["Body"].(map[string]interface{})["Text"] = map[string]string{"Data": message.Text}
+		}
+		if message.ListUnsubscribe != "" {
+			simple["Headers"] = []interface{}{map[string]string{"Name": "List-Unsubscribe", "Value": message.ListUnsubscribe}}
+		}
+		payload := map[string]interface{}{
+			"FromEmailAddress": message.from(),
+			"Destination":      map[string][]string{"ToAddresses": {message.To}},
+			"Content":          map[string]interface{}{"Simple": simple},
+		}
+		if message.ReplyTo != "" {
+			payload["ReplyToAddresses"] = []string{message.ReplyTo}
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, t.baseURL+"/v2/email/outbound-emails", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		signV4(req, body, t.key, t.secret, t.region, "ses", time.Now())
+		return req, nil
+	}
+}
+
+// newJSONRequest creates a POST request with a json body
+func newJSONRequest(url string, payload interface{}) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// signV4 signs the request using the AWS signature version 4, with the content-type, host and x-amz-date headers
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	const signedHeaders = "content-type;host;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(params, "&"),
+		"content-type:" + req.Header.Get("Content-Type") + "\n" + "host:" + req.URL.Host + "\n" + "x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
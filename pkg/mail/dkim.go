@@ -0,0 +1,146 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+// dkimHeaders are the headers signed when they are present in the message
+var dkimHeaders = []string{"from", "reply-to", "to", "subject", "date", "message-id", "mime-version", "content-type", "list-unsubscribe"}
+
+var whitespaces = regexp.MustCompile(`[ \t]+`)
+
+// dkimSigner signs the messages with DKIM, using the rsa-sha256 algorithm and the relaxed canonicalization
+type dkimSigner struct {
+	domain   string
+	selector string
+	key      *rsa.PrivateKey
+}
+
+// newDKIMSigner creates the signer of the configuration, it returns nil when no DKIM domain is configured
+func newDKIMSigner(config *config.Email) (*dkimSigner, error) {
+	if config.DKIM.Domain == "" {
+		return nil, nil
+	}
+	if config.DKIM.Selector == "" {
+		return nil, errors.New("the dkim signature requires a selector")
+	}
+	content := []byte(config.DKIM.PrivateKey)
+	if len(content) == 0 {
+		var err error
+		if content, err = ioutil.ReadFile(config.DKIM.PrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	key, err := parseRSAKey(content)
+	if err != nil {
+		return nil, err
+	}
+	return &dkimSigner{domain: config.DKIM.Domain, selector: config.DKIM.Selector, key: key}, nil
+}
+
+// parseRSAKey parses a PKCS#1 or PKCS#8 PEM encoded rsa private key
+func parseRSAKey(content []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("the dkim private key isn't PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the dkim private key isn't a rsa key")
+	}
+	return rsaKey, nil
+}
+
+// Sign returns the message prefixed with its DKIM-Signature header
+func (s *dkimSigner) Sign(message []byte, now time.Time) ([]byte, error) {
+	i := bytes.Index(message, []byte("\r\n\r\n"))
+	if i < 0 {
+		return nil, errors.New("the message has no body")
+	}
+	headers := parseHeaders(string(message[:i+2]))
+	bodyHash := sha256.Sum256([]byte(relaxedBody(string(message[i+4:]))))
+
+	var names []string
+	var signed bytes.Buffer
+	for _, name := range dkimHeaders {
+		if value, ok := headers[name]; ok {
+			names = append(names, name)
+			signed.WriteString(relaxedHeader(name, value))
+		}
+	}
+	value := fmt.Sprintf("v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s; t=%s; h=%s; bh=%s; b=",
+		s.domain, s.selector, strconv.FormatInt(now.Unix(), 10), strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	// The signature header is signed without its trailing CRLF, and with an empty b= tag
+	signed.WriteString(strings.TrimSuffix(relaxedHeader("dkim-signature", value), "\r\n"))
+
+	hash := sha256.Sum256(signed.Bytes())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	header := "DKIM-Signature: " + value + base64.StdEncoding.EncodeToString(signature) + "\r\n"
+	return append([]byte(header), message...), nil
+}
+
+// parseHeaders returns the unfolded values of the headers, keyed by their lowercased name
+func parseHeaders(section string) map[string]string {
+	headers := make(map[string]string)
+	var name string
+	for _, line := range strings.Split(strings.TrimSuffix(section, "\r\n"), "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && name != "" {
+			headers[name] += line
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(line[:i]))
+		headers[name] = line[i+1:]
+	}
+	return headers
+}
+
+// relaxedHeader canonicalizes a header with the relaxed algorithm of RFC 6376
+func relaxedHeader(name, value string) string {
+	value = strings.Replace(value, "\r\n", "", -1)
+	return name + ":" + strings.TrimSpace(whitespaces.ReplaceAllString(value, " ")) + "\r\n"
+}
+
+// relaxedBody canonicalizes a body with the relaxed algorithm of RFC 6376
+func relaxedBody(body string) string {
+	lines := strings.Split(body, "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(whitespaces.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
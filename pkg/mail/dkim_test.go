@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDKIMSign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &dkimSigner{domain: "app.com", selector: "mail", key: key}
+	message := "From: App <noreply@app.com>\r\nTo: alexandre@google.com\r\nSubject:  Please   confirm\r\n your account\r\nX-Mailer: test\r\n\r\nHello  world \r\n\r\n\r\n"
+	signed, err := signer.Sign([]byte(message), time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := strings.SplitN(string(signed), "\r\n", 2)[0]
+	if !strings.HasSuffix(string(signed), message) {
+		t.Fatal("Expected the message to be kept unchanged after the signature")
+	}
+	// The body hash of the canonicalized body: "Hello world\r\n"
+	prefix := "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=app.com; s=mail; t=1500000000; h=from:to:subject; bh=yGIXoM91E1DiKjvCBcC8NlWyw54TdfMQ08sdtwtOO4I=; b="
+	if !strings.HasPrefix(header, prefix) {
+		t.Fatalf("Unexpected signature header: %v", header)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonicalized := "from:App <noreply@app.com>\r\nto:alexandre@google.com\r\nsubject:Please confirm your account\r\n" + "dkim-signature:" + strings.TrimPrefix(prefix, "DKIM-Signature: ")
+	hash := sha256.Sum256([]byte(canonicalized))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+		t.Errorf("Invalid signature: %v", err)
+	}
+}
@@ -1,8 +1,20 @@
 package mail
 
 import (
-	"github.com/labstack/gommon/log"
+	"database/sql"
+	"sync"
+	"time"
+
 	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/retry"
+	"github.com/labstack/gommon/log"
+)
+
+// The statuses of a queued email
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"
 )
 
 // EmailSendRequest represents a mail sending request
@@ -10,54 +22,164 @@ type EmailSendRequest struct {
 	To      string
 	Title   string
 	Content string
+	Text    string
+	// Unsubscribe adds the List-Unsubscribe header to the email
+	Unsubscribe bool
+}
+
+// Queue stores the emails to send in the database, so they survive restarts
+type Queue struct {
+	db    *sql.DB
+	table string
+}
+
+// NewQueue creates a new Queue storing the emails in the provided table
+func NewQueue(db *sql.DB, table string) *Queue {
+	return &Queue{
+		db:    db,
+		table: table,
+	}
+}
+
+// Enqueue stores an email to send
+func (q *Queue) Enqueue(request EmailSendRequest) error {
+	_, err := q.db.Exec("INSERT INTO "+q.table+"(recipient, subject, content, text_content, unsubscribe) VALUES($1, $2, $3, $4, $5)", request.To, request.Title, request.Content, request.Text, request.Unsubscribe)
+	return err
 }
 
+// purgeInterval is the minimum delay between two deletions of the old emails
+const purgeInterval = time.Hour
+
 // Worker is the struct maintaining worker's state
+// It sends the queued emails using a pool of goroutines
 type Worker struct {
-	ID          int
-	WorkerQueue chan EmailSendRequest
-	QuitChan    chan bool
+	db          *sql.DB
+	table       string
+	size        int
+	interval    time.Duration
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	retention   time.Duration
+	quitChan    chan bool
+	wg          sync.WaitGroup
 	sender      *sender
 	logger      *log.Logger
+	mu          sync.Mutex
+	lastPurge   time.Time
 }
 
-// NewSenderWorker creates, and returns a new Worker object.
-func NewSenderWorker(workerQueue chan EmailSendRequest, config *config.Email, logger *log.Logger) *Worker {
+// NewSenderWorker creates, and returns a new Worker object sending the emails queued in the provided table.
+func NewSenderWorker(db *sql.DB, table string, config *config.Email, logger *log.Logger) (*Worker, error) {
+	sender, err := newSender(config)
+	if err != nil {
+		return nil, err
+	}
 	return &Worker{
-		WorkerQueue: workerQueue,
-		QuitChan:    make(chan bool),
-		sender:      newSender(config),
+		db:          db,
+		table:       table,
+		size:        config.Workers,
+		interval:    config.PollInterval,
+		maxAttempts: config.MaxAttempts,
+		retryBase:   config.RetryBase,
+		retryMax:    config.RetryMax,
+		retention:   config.Retention,
+		quitChan:    make(chan bool),
+		sender:      sender,
 		logger:      logger,
-	}
+	}, nil
 }
 
-// Start launches the worker by starting a goroutine
+// Start launches the worker by starting its goroutines
 func (w *Worker) Start() {
-	go func() {
-		for {
-			select {
-			case work := <-w.WorkerQueue:
-				// Receive a work request.
-				w.logger.Info("worker: Received email sending request \n")
-
-				err := w.sender.sendEmail(work.To, work.Title, work.Content)
+	for i := 0; i < w.size; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for {
+				select {
+				case <-w.quitChan:
+					return
+				default:
+				}
+				sent, err := w.sendNext()
 				if err != nil {
-					w.logger.Errorf("An error occurred while sending email: %v \n", err.Error())
+					w.logger.Errorf("An error occurred while polling the email queue: %v \n", err.Error())
+				}
+				// Keep going while there are emails to send
+				if sent {
+					continue
+				}
+				if err := w.purge(); err != nil {
+					w.logger.Errorf("An error occurred while purging the email queue: %v \n", err.Error())
+				}
+				select {
+				case <-w.quitChan:
+					return
+				case <-time.After(w.interval):
 				}
-
-			case <-w.QuitChan:
-				// We have been asked to stop.
-				w.logger.Info("Stopping worker ...\n")
-				return
 			}
-		}
-	}()
+		}()
+	}
 }
 
-// Stop tells the worker to stop listening for work requests.
-// Note that the worker will only stop *after* it has finished its work.
+// Stop tells the worker to stop polling the queue.
+// It returns once the emails being sent are sent.
 func (w *Worker) Stop() {
-	go func() {
-		w.QuitChan <- true
-	}()
+	w.logger.Info("Stopping worker ...\n")
+	close(w.quitChan)
+	w.wg.Wait()
+}
+
+// sendNext sends the next due email, locking it so the other goroutines and replicas skip it
+// It returns false when no email is due
+func (w *Worker) sendNext() (bool, error) {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var attempts int
+	var request EmailSendRequest
+	err = tx.QueryRow("SELECT id, recipient, subject, content, text_content, unsubscribe, attempts FROM "+w.table+" WHERE status = $1 AND next_attempt_at <= now() ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED", StatusPending).Scan(&id, &request.To, &request.Title, &request.Content, &request.Text, &request.Unsubscribe, &attempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	attempts++
+	if sendErr := w.sender.sendEmail(request); sendErr != nil {
+		status := StatusPending
+		if attempts >= w.maxAttempts {
+			status = StatusDead
+			w.logger.Errorf("Giving up sending email %v after %v attempts: %v \n", id, attempts, sendErr.Error())
+		} else {
+			w.logger.Warnf("An error occurred while sending email %v: %v \n", id, sendErr.Error())
+		}
+		_, err = tx.Exec("UPDATE "+w.table+" SET status = $1, attempts = $2, last_error = $3, next_attempt_at = now() + $4 * interval '1 second' WHERE id = $5", status, attempts, sendErr.Error(), retry.Backoff(attempts, w.retryBase, w.retryMax).Seconds(), id)
+	} else {
+		// The content of the sent emails is removed, as it contains the confirmation, reset and unlock links
+		_, err = tx.Exec("UPDATE "+w.table+" SET status = $1, attempts = $2, last_error = NULL, sent_at = now(), content = '', text_content = '' WHERE id = $3", StatusSent, attempts, id)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// purge deletes the sent and dead emails queued before the retention period, at most once per purgeInterval
+func (w *Worker) purge() error {
+	w.mu.Lock()
+	if time.Since(w.lastPurge) < purgeInterval {
+		w.mu.Unlock()
+		return nil
+	}
+	w.lastPurge = time.Now()
+	w.mu.Unlock()
+	_, err := w.db.Exec("DELETE FROM "+w.table+" WHERE status <> $1 AND created_at < now() - $2 * interval '1 second'", StatusPending, w.retention.Seconds())
+	return err
 }
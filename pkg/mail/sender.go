@@ -2,30 +2,45 @@ package mail
 
 import (
 	"github.com/alexandrevilain/postgrest-auth/pkg/config"
-	gomail "gopkg.in/gomail.v2"
 )
 
 // sender is the config for sending emails
 type sender struct {
-	from   string
-	dialer *gomail.Dialer
+	from            string
+	fromName        string
+	replyTo         string
+	listUnsubscribe string
+	transport       Transport
 }
 
 // NewSender creates a new instance of sender to manage mail sending of the app
-func newSender(config *config.Email) *sender {
-	return &sender{
-		from:   config.From,
-		dialer: gomail.NewPlainDialer(config.Host, config.Port, config.Auth.User, config.Auth.Pass),
+func newSender(config *config.Email) (*sender, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
 	}
+	return &sender{
+		from:            config.From,
+		fromName:        config.FromName,
+		replyTo:         config.ReplyTo,
+		listUnsubscribe: config.ListUnsubscribe,
+		transport:       transport,
+	}, nil
 }
 
-// sendEmail send email using the config of the sender struct
-func (s *sender) sendEmail(to, subject, content string) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", s.from)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", content)
-
-	return s.dialer.DialAndSend(m)
+// sendEmail send email using the transport of the sender struct
+func (s *sender) sendEmail(request EmailSendRequest) error {
+	message := Message{
+		From:     s.from,
+		FromName: s.fromName,
+		To:       request.To,
+		ReplyTo:  s.replyTo,
+		Subject:  request.Title,
+		HTML:     request.Content,
+		Text:     request.Text,
+	}
+	if request.Unsubscribe {
+		message.ListUnsubscribe = s.listUnsubscribe
+	}
+	return s.transport.Send(message)
 }
@@ -1,79 +1,457 @@
 package mail
 
 import (
-	"github.com/matcornic/hermes"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
 	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/i18n"
+	"github.com/matcornic/hermes"
+)
+
+// The names of the email templates
+const (
+	TemplateConfirm = "confirm"
+	TemplateReset   = "reset"
+	TemplateUnlock  = "unlock"
+
+	// The security notifications, their link revokes the sessions of the user and starts a password reset
+	TemplatePasswordChanged = "password_changed"
+	TemplateNewSignin       = "new_signin"
 )
 
+// requiredTemplates are the emails needed to use the account, they can't be unsubscribed from
+var requiredTemplates = map[string]bool{
+	TemplateConfirm: true,
+	TemplateReset:   true,
+	TemplateUnlock:  true,
+}
+
+// defaultLayouts are the blocks shared by the templates of a locale
+var defaultLayouts = map[string]string{
+	"en": `
+{{ define "greeting" }}Hi{{ end }}
+{{ define "signature" }}Yours truly{{ end }}
+{{ define "trouble" }}If you’re having trouble with the button '{ACTION}', copy and paste the URL below into your web browser.{{ end }}
+{{ define "color" }}{{ end }}
+`,
+	"fr": `
+{{ define "greeting" }}Bonjour{{ end }}
+{{ define "signature" }}Cordialement{{ end }}
+{{ define "trouble" }}Si le bouton '{ACTION}' ne fonctionne pas, copiez et collez l'adresse ci-dessous dans votre navigateur.{{ end }}
+`,
+	"de": `
+{{ define "greeting" }}Hallo{{ end }}
+{{ define "signature" }}Mit freundlichen Grüßen{{ end }}
+{{ define "trouble" }}Falls die Schaltfläche '{ACTION}' nicht funktioniert, kopieren Sie die folgende URL in Ihren Browser.{{ end }}
+`,
+	"es": `
+{{ define "greeting" }}Hola{{ end }}
+{{ define "signature" }}Atentamente{{ end }}
+{{ define "trouble" }}Si tienes problemas con el botón '{ACTION}', copia y pega la siguiente URL en tu navegador.{{ end }}
+`,
+}
+
+// defaultTemplates are the wording of the emails per locale, the english wording is used for the blocks a locale doesn't define
+// A template file of the templates directory can redefine any of their blocks
+// The intros and outros blocks contain a paragraph per line
+var defaultTemplates = map[string]map[string]string{
+	"en": {
+		TemplateConfirm: `
+{{ define "subject" }}Please confirm your account{{ end }}
+{{ define "intros" }}Welcome to {{ .App.Name }}! We're very excited to have you on board.{{ end }}
+{{ define "instructions" }}To get started with {{ .App.Name }}, please click here:{{ end }}
+{{ define "button" }}Confirm your account{{ end }}
+{{ define "outros" }}Need help, or have questions? Just reply to this email, we'd love to help.{{ end }}
+`,
+		TemplateReset: `
+{{ define "subject" }}Here is your reset link{{ end }}
+{{ define "intros" }}You have received this email because a password reset request for {{ .App.Name }} account was received.{{ end }}
+{{ define "instructions" }}Click the button below to reset your password:{{ end }}
+{{ define "button" }}Reset your password{{ end }}
+{{ define "color" }}#DC4D2F{{ end }}
+{{ define "outros" }}If you did not request a password reset, no further action is required on your part.{{ end }}
+{{ define "signature" }}Thanks{{ end }}
+`,
+		TemplateUnlock: `
+{{ define "subject" }}Your account has been locked{{ end }}
+{{ define "intros" }}Your {{ .App.Name }} account has been temporarily locked after too many failed sign in attempts.{{ end }}
+{{ define "instructions" }}If you were trying to sign in, click the button below to unlock your account:{{ end }}
+{{ define "button" }}Unlock your account{{ end }}
+{{ define "color" }}#DC4D2F{{ end }}
+{{ define "outros" }}If you did not try to sign in, someone may be trying to guess your password. We recommend you to reset it.{{ end }}
+{{ define "signature" }}Thanks{{ end }}
+`,
+		TemplatePasswordChanged: `
+{{ define "subject" }}Your password has been changed{{ end }}
+{{ define "intros" }}The password of your {{ .App.Name }} account has just been changed.{{ end }}
+{{ define "instructions" }}If you didn't change it, click the button below to sign out everywhere and reset your password:{{ end }}
+{{ define "button" }}This wasn't me{{ end }}
+{{ define "color" }}#DC4D2F{{ end }}
+{{ define "outros" }}If you changed your password, you can safely ignore this email.{{ end }}
+`,
+		TemplateNewSignin: `
+{{ define "subject" }}New sign in to your account{{ end }}
+{{ define "intros" }}
+Your {{ .App.Name }} account has just been signed in to from a new device.
+Device: {{ .Details.device }}
+IP address: {{ .Details.ip }}{{ if .Details.country }}
+Country: {{ .Details.country }}{{ end }}
+{{ end }}
+{{ define "instructions" }}If this wasn't you, click the button below to sign out everywhere and reset your password:{{ end }}
+{{ define "button" }}This wasn't me{{ end }}
+{{ define "color" }}#DC4D2F{{ end }}
+{{ define "outros" }}If it was you, you can safely ignore this email.{{ end }}
+`,
+	},
+	"fr": {
+		TemplateConfirm: `
+{{ define "subject" }}Veuillez confirmer votre compte{{ end }}
+{{ define "intros" }}Bienvenue sur {{ .App.Name }} ! Nous sommes ravis de vous compter parmi nous.{{ end }}
+{{ define "instructions" }}Pour commencer à utiliser {{ .App.Name }}, cliquez ici :{{ end }}
+{{ define "button" }}Confirmer votre compte{{ end }}
+{{ define "outros" }}Besoin d'aide, ou une question ? Répondez simplement à cet email, nous serons ravis de vous aider.{{ end }}
+`,
+		TemplateReset: `
+{{ define "subject" }}Voici votre lien de réinitialisation{{ end }}
+{{ define "intros" }}Vous recevez cet email car une demande de réinitialisation du mot de passe de votre compte {{ .App.Name }} a été reçue.{{ end }}
+{{ define "instructions" }}Cliquez sur le bouton ci-dessous pour réinitialiser votre mot de passe :{{ end }}
+{{ define "button" }}Réinitialiser votre mot de passe{{ end }}
+{{ define "outros" }}Si vous n'avez pas demandé de réinitialisation, aucune action n'est requise de votre part.{{ end }}
+{{ define "signature" }}Merci{{ end }}
+`,
+		TemplateUnlock: `
+{{ define "subject" }}Votre compte a été verrouillé{{ end }}
+{{ define "intros" }}Votre compte {{ .App.Name }} a été temporairement verrouillé après trop de tentatives de connexion échouées.{{ end }}
+{{ define "instructions" }}Si vous essayiez de vous connecter, cliquez sur le bouton ci-dessous pour déverrouiller votre compte :{{ end }}
+{{ define "button" }}Déverrouiller votre compte{{ end }}
+{{ define "outros" }}Si vous n'avez pas essayé de vous connecter, quelqu'un tente peut-être de deviner votre mot de passe. Nous vous recommandons de le réinitialiser.{{ end }}
+{{ define "signature" }}Merci{{ end }}
+`,
+		TemplatePasswordChanged: `
+{{ define "subject" }}Votre mot de passe a été modifié{{ end }}
+{{ define "intros" }}Le mot de passe de votre compte {{ .App.Name }} vient d'être modifié.{{ end }}
+{{ define "instructions" }}Si vous ne l'avez pas modifié, cliquez sur le bouton ci-dessous pour vous déconnecter partout et réinitialiser votre mot de passe :{{ end }}
+{{ define "button" }}Ce n'était pas moi{{ end }}
+{{ define "outros" }}Si vous avez modifié votre mot de passe, vous pouvez ignorer cet email.{{ end }}
+`,
+		TemplateNewSignin: `
+{{ define "subject" }}Nouvelle connexion à votre compte{{ end }}
+{{ define "intros" }}
+Une connexion à votre compte {{ .App.Name }} vient d'avoir lieu depuis un nouvel appareil.
+Appareil : {{ .Details.device }}
+Adresse IP : {{ .Details.ip }}{{ if .Details.country }}
+Pays : {{ .Details.country }}{{ end }}
+{{ end }}
+{{ define "instructions" }}Si ce n'était pas vous, cliquez sur le bouton ci-dessous pour vous déconnecter partout et réinitialiser votre mot de passe :{{ end }}
+{{ define "button" }}Ce n'était pas moi{{ end }}
+{{ define "outros" }}Si c'était vous, vous pouvez ignorer cet email.{{ end }}
+`,
+	},
+	"de": {
+		TemplateConfirm: `
+{{ define "subject" }}Bitte bestätigen Sie Ihr Konto{{ end }}
+{{ define "intros" }}Willkommen bei {{ .App.Name }}! Wir freuen uns sehr, Sie an Bord zu haben.{{ end }}
+{{ define "instructions" }}Um mit {{ .App.Name }} zu beginnen, klicken Sie bitte hier:{{ end }}
+{{ define "button" }}Konto bestätigen{{ end }}
+{{ define "outros" }}Brauchen Sie Hilfe oder haben Sie Fragen? Antworten Sie einfach auf diese E-Mail, wir helfen Ihnen gerne.{{ end }}
+`,
+		TemplateReset: `
+{{ define "subject" }}Ihr Link zum Zurücksetzen{{ end }}
+{{ define "intros" }}Sie erhalten diese E-Mail, weil eine Anfrage zum Zurücksetzen des Passworts Ihres {{ .App.Name }}-Kontos eingegangen ist.{{ end }}
+{{ define "instructions" }}Klicken Sie auf die Schaltfläche unten, um Ihr Passwort zurückzusetzen:{{ end }}
+{{ define "button" }}Passwort zurücksetzen{{ end }}
+{{ define "outros" }}Wenn Sie das Zurücksetzen nicht angefordert haben, müssen Sie nichts weiter tun.{{ end }}
+{{ define "signature" }}Danke{{ end }}
+`,
+		TemplateUnlock: `
+{{ define "subject" }}Ihr Konto wurde gesperrt{{ end }}
+{{ define "intros" }}Ihr {{ .App.Name }}-Konto wurde nach zu vielen fehlgeschlagenen Anmeldeversuchen vorübergehend gesperrt.{{ end }}
+{{ define "instructions" }}Wenn Sie versucht haben, sich anzumelden, klicken Sie auf die Schaltfläche unten, um Ihr Konto zu entsperren:{{ end }}
+{{ define "button" }}Konto entsperren{{ end }}
+{{ define "outros" }}Wenn Sie nicht versucht haben, sich anzumelden, versucht möglicherweise jemand, Ihr Passwort zu erraten. Wir empfehlen Ihnen, es zurückzusetzen.{{ end }}
+{{ define "signature" }}Danke{{ end }}
+`,
+		TemplatePasswordChanged: `
+{{ define "subject" }}Ihr Passwort wurde geändert{{ end }}
+{{ define "intros" }}Das Passwort Ihres {{ .App.Name }}-Kontos wurde soeben geändert.{{ end }}
+{{ define "instructions" }}Wenn Sie es nicht geändert haben, klicken Sie auf die Schaltfläche unten, um sich überall abzumelden und Ihr Passwort zurückzusetzen:{{ end }}
+{{ define "button" }}Das war ich nicht{{ end }}
+{{ define "outros" }}Wenn Sie Ihr Passwort geändert haben, können Sie diese E-Mail ignorieren.{{ end }}
+`,
+		TemplateNewSignin: `
+{{ define "subject" }}Neue Anmeldung bei Ihrem Konto{{ end }}
+{{ define "intros" }}
+Bei Ihrem {{ .App.Name }}-Konto hat sich soeben ein neues Gerät angemeldet.
+Gerät: {{ .Details.device }}
+IP-Adresse: {{ .Details.ip }}{{ if .Details.country }}
+Land: {{ .Details.country }}{{ end }}
+{{ end }}
+{{ define "instructions" }}Wenn Sie das nicht waren, klicken Sie auf die Schaltfläche unten, um sich überall abzumelden und Ihr Passwort zurückzusetzen:{{ end }}
+{{ define "button" }}Das war ich nicht{{ end }}
+{{ define "outros" }}Wenn Sie das waren, können Sie diese E-Mail ignorieren.{{ end }}
+`,
+	},
+	"es": {
+		TemplateConfirm: `
+{{ define "subject" }}Por favor, confirma tu cuenta{{ end }}
+{{ define "intros" }}¡Bienvenido a {{ .App.Name }}! Estamos encantados de tenerte con nosotros.{{ end }}
+{{ define "instructions" }}Para empezar a usar {{ .App.Name }}, haz clic aquí:{{ end }}
+{{ define "button" }}Confirmar tu cuenta{{ end }}
+{{ define "outros" }}¿Necesitas ayuda o tienes preguntas? Responde a este correo, estaremos encantados de ayudarte.{{ end }}
+`,
+		TemplateReset: `
+{{ define "subject" }}Aquí tienes tu enlace de restablecimiento{{ end }}
+{{ define "intros" }}Has recibido este correo porque se solicitó restablecer la contraseña de tu cuenta de {{ .App.Name }}.{{ end }}
+{{ define "instructions" }}Haz clic en el botón de abajo para restablecer tu contraseña:{{ end }}
+{{ define "button" }}Restablecer tu contraseña{{ end }}
+{{ define "outros" }}Si no solicitaste restablecer tu contraseña, no tienes que hacer nada.{{ end }}
+{{ define "signature" }}Gracias{{ end }}
+`,
+		TemplateUnlock: `
+{{ define "subject" }}Tu cuenta ha sido bloqueada{{ end }}
+{{ define "intros" }}Tu cuenta de {{ .App.Name }} ha sido bloqueada temporalmente tras demasiados intentos fallidos de inicio de sesión.{{ end }}
+{{ define "instructions" }}Si intentabas iniciar sesión, haz clic en el botón de abajo para desbloquear tu cuenta:{{ end }}
+{{ define "button" }}Desbloquear tu cuenta{{ end }}
+{{ define "outros" }}Si no intentaste iniciar sesión, puede que alguien esté intentando adivinar tu contraseña. Te recomendamos restablecerla.{{ end }}
+{{ define "signature" }}Gracias{{ end }}
+`,
+		TemplatePasswordChanged: `
+{{ define "subject" }}Tu contraseña ha sido cambiada{{ end }}
+{{ define "intros" }}La contraseña de tu cuenta de {{ .App.Name }} acaba de ser cambiada.{{ end }}
+{{ define "instructions" }}Si no la cambiaste, haz clic en el botón de abajo para cerrar todas tus sesiones y restablecer tu contraseña:{{ end }}
+{{ define "button" }}No fui yo{{ end }}
+{{ define "outros" }}Si cambiaste tu contraseña, puedes ignorar este correo.{{ end }}
+`,
+		TemplateNewSignin: `
+{{ define "subject" }}Nuevo inicio de sesión en tu cuenta{{ end }}
+{{ define "intros" }}
+Se acaba de iniciar sesión en tu cuenta de {{ .App.Name }} desde un nuevo dispositivo.
+Dispositivo: {{ .Details.device }}
+Dirección IP: {{ .Details.ip }}{{ if .Details.country }}
+País: {{ .Details.country }}{{ end }}
+{{ end }}
+{{ define "instructions" }}Si no fuiste tú, haz clic en el botón de abajo para cerrar todas tus sesiones y restablecer tu contraseña:{{ end }}
+{{ define "button" }}No fui yo{{ end }}
+{{ define "outros" }}Si fuiste tú, puedes ignorar este correo.{{ end }}
+`,
+	},
+}
+
+// Recipient is the user receiving an email, available as .User in the templates
+type Recipient struct {
+	ID       string
+	Email    string
+	Locale   string
+	Metadata map[string]interface{}
+}
+
+// Email is a generated email
+type Email struct {
+	Subject string
+	HTML    string
+	Text    string
+	// Unsubscribe is true when the recipient can opt out of the email
+	Unsubscribe bool
+}
+
+// templateData is the data available in the templates
+type templateData struct {
+	App     config.App
+	User    Recipient
+	Link    string
+	Details map[string]string
+}
+
 // EmailGenerator is the struct keeping the base config of hermes
 type EmailGenerator struct {
-	hermes hermes.Hermes
+	hermes        hermes.Hermes
+	app           config.App
+	defaultLocale string
+	templates     map[string]map[string]*template.Template
 }
 
-// NewEmailGenerator creates the base config of hermes
-func NewEmailGenerator(config *config.App) *EmailGenerator {
+// NewEmailGenerator creates the base config of hermes and loads the templates of every locale
+// The locales are the built-in ones and the subdirectories of the templates directory
+func NewEmailGenerator(config *config.App, defaultLocale string) (*EmailGenerator, error) {
+	copyright := config.Copyright
+	if copyright == "" {
+		copyright = fmt.Sprintf("Copyright © %v %v. All rights reserved.", time.Now().Year(), config.Name)
+	}
 	h := hermes.Hermes{
 		Product: hermes.Product{
 			Name:      config.Name,
 			Link:      config.Link,
 			Logo:      config.Logo,
-			Copyright: "Copyright © 2017 " + config.Name + ". All rights reserved.",
+			Copyright: copyright,
 		},
 	}
-	h.Theme = new(hermes.Flat)
-	return &EmailGenerator{
-		hermes: h,
+	switch config.Theme {
+	case "flat":
+		h.Theme = new(hermes.Flat)
+	case "default":
+		h.Theme = new(hermes.Default)
+	default:
+		return nil, fmt.Errorf("unknown email theme: %s", config.Theme)
+	}
+
+	locales := make(map[string]bool)
+	for locale := range defaultTemplates {
+		locales[locale] = true
+	}
+	if config.TemplatesDir != "" {
+		files, err := ioutil.ReadDir(config.TemplatesDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				locales[i18n.Normalize(file.Name())] = true
+			}
+		}
 	}
+
+	g := &EmailGenerator{
+		hermes:        h,
+		app:           *config,
+		defaultLocale: i18n.Normalize(defaultLocale),
+		templates:     make(map[string]map[string]*template.Template),
+	}
+	for locale := range locales {
+		g.templates[locale] = make(map[string]*template.Template)
+		for _, name := range Templates() {
+			t, err := g.load(locale, name, config.TemplatesDir)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v email template for the %v locale: %v", name, locale, err.Error())
+			}
+			g.templates[locale][name] = t
+		}
+	}
+	if !locales[g.defaultLocale] {
+		return nil, fmt.Errorf("no email templates for the default locale: %s", defaultLocale)
+	}
+	return g, nil
 }
 
-// GenerateConfirmEmail generate a custom confirm email
-func (g *EmailGenerator) GenerateConfirmEmail(fullname string, link string) (string, error) {
-	email := hermes.Email{
-		Body: hermes.Body{
-			Name: fullname,
-			Intros: []string{
-				"Welcome to " + g.hermes.Product.Name + "! We're very excited to have you on board.",
-			},
-			Actions: []hermes.Action{
-				{
-					Instructions: "To get started with " + g.hermes.Product.Name + ", please click here:",
-					Button: hermes.Button{
-						Text: "Confirm your account",
-						Link: link,
-					},
-				},
-			},
-			Outros: []string{
-				"Need help, or have questions? Just reply to this email, we'd love to help.",
-			},
-		},
+// load parses the template of a locale: the english blocks, then the ones of the locale, then the overrides of the templates directory
+// The files at the root of the templates directory override the templates of the default locale
+func (g *EmailGenerator) load(locale, name, dir string) (*template.Template, error) {
+	t := template.New(name)
+	for _, text := range []string{defaultLayouts["en"], defaultLayouts[locale], defaultTemplates["en"][name], defaultTemplates[locale][name]} {
+		if _, err := t.Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return t, nil
+	}
+	var files []string
+	if locale == g.defaultLocale {
+		files = append(files, filepath.Join(dir, "layout.tmpl"), filepath.Join(dir, name+".tmpl"))
+	}
+	files = append(files, filepath.Join(dir, locale, "layout.tmpl"), filepath.Join(dir, locale, name+".tmpl"))
+	for _, file := range files {
+		override, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.Parse(string(override)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Templates returns the names of the email templates
+func Templates() []string {
+	names := make([]string, 0, len(defaultTemplates["en"]))
+	for name := range defaultTemplates["en"] {
+		names = append(names, name)
 	}
-	return g.hermes.GenerateHTML(email)
+	sort.Strings(names)
+	return names
 }
 
-// GenerateRestePasswordEmail generate a custom reset password email
-func (g *EmailGenerator) GenerateRestePasswordEmail(fullname string, link string) (string, error) {
+// locale returns the locale of the templates used for the recipient
+func (g *EmailGenerator) locale(locale string) string {
+	locale = i18n.Normalize(locale)
+	if _, ok := g.templates[locale]; ok {
+		return locale
+	}
+	if i := strings.Index(locale, "-"); i > 0 {
+		if _, ok := g.templates[locale[:i]]; ok {
+			return locale[:i]
+		}
+	}
+	return g.defaultLocale
+}
+
+// Generate renders the template for the recipient, the link is the one of the email's button
+// The details are the values specific to the template, like the device of a new sign in
+func (g *EmailGenerator) Generate(name string, recipient Recipient, link string, details map[string]string) (Email, error) {
+	t, ok := g.templates[g.locale(recipient.Locale)][name]
+	if !ok {
+		return Email{}, fmt.Errorf("unknown email template: %s", name)
+	}
+	data := templateData{App: g.app, User: recipient, Link: link, Details: details}
+	blocks := make(map[string]string)
+	for _, block := range []string{"subject", "greeting", "intros", "instructions", "button", "color", "outros", "signature", "trouble"} {
+		var out bytes.Buffer
+		if err := t.ExecuteTemplate(&out, block, data); err != nil {
+			return Email{}, err
+		}
+		blocks[block] = strings.TrimSpace(out.String())
+	}
+
 	email := hermes.Email{
 		Body: hermes.Body{
-			Name: fullname,
-			Intros: []string{
-				"You have received this email because a password reset request for " + g.hermes.Product.Name + " account was received.",
-			},
+			Name:     recipient.Email,
+			Greeting: blocks["greeting"],
+			Intros:   paragraphs(blocks["intros"]),
 			Actions: []hermes.Action{
 				{
-					Instructions: "Click the button below to reset your password:",
+					Instructions: blocks["instructions"],
 					Button: hermes.Button{
-						Color: "#DC4D2F",
-						Text:  "Reset your password",
+						Color: blocks["color"],
+						Text:  blocks["button"],
 						Link:  link,
 					},
 				},
 			},
-			Outros: []string{
-				"If you did not request a password reset, no further action is required on your part.",
-			},
-			Signature: "Thanks",
+			Outros:    paragraphs(blocks["outros"]),
+			Signature: blocks["signature"],
 		},
 	}
-	return g.hermes.GenerateHTML(email)
+	h := g.hermes
+	h.Product.TroubleText = blocks["trouble"]
+	html, err := h.GenerateHTML(email)
+	if err != nil {
+		return Email{}, err
+	}
+	text, err := h.GeneratePlainText(email)
+	if err != nil {
+		return Email{}, err
+	}
+	return Email{Subject: blocks["subject"], HTML: html, Text: text, Unsubscribe: !requiredTemplates[name]}, nil
+}
+
+// paragraphs splits a block into its non-empty lines
+func paragraphs(block string) []string {
+	var lines []string
+	for _, line := range strings.Split(block, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
 }
@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+func TestGenerateDefaultTemplates(t *testing.T) {
+	generator, err := NewEmailGenerator(&config.App{Name: "MyApp", Theme: "flat"}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range Templates() {
+		email, err := generator.Generate(name, Recipient{Email: "alexandre@google.com"}, "http://localhost/link", nil)
+		if err != nil {
+			t.Errorf("Unable to generate the %v email: %v", name, err)
+			continue
+		}
+		if email.Subject == "" || !strings.Contains(email.HTML, "http://localhost/link") || !strings.Contains(email.Text, "http://localhost/link") {
+			t.Errorf("Unexpected %v email: %v", name, email.Subject)
+		}
+	}
+}
+
+func TestGenerateOverriddenTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	override := `{{ define "subject" }}Bienvenue {{ .User.Metadata.name }}{{ end }}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "confirm.tmpl"), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator, err := NewEmailGenerator(&config.App{Name: "MyApp", Theme: "default", TemplatesDir: dir}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := Recipient{Email: "alexandre@google.com", Metadata: map[string]interface{}{"name": "Alexandre"}}
+	email, err := generator.Generate(TemplateConfirm, recipient, "http://localhost/confirm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Bienvenue Alexandre" {
+		t.Errorf("Expected the overridden subject, got: %v", email.Subject)
+	}
+	// The blocks which aren't redefined keep their default wording
+	if !strings.Contains(email.HTML, "Confirm your account") {
+		t.Error("Expected the default button text")
+	}
+}
+
+func TestUnknownTheme(t *testing.T) {
+	if _, err := NewEmailGenerator(&config.App{Theme: "dark"}, "en"); err == nil {
+		t.Error("Expected an error for an unknown theme")
+	}
+}
+
+func TestGenerateLocalizedTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "it"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	override := `{{ define "subject" }}Conferma il tuo account{{ end }}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "it", "confirm.tmpl"), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator, err := NewEmailGenerator(&config.App{Name: "MyApp", Theme: "flat", TemplatesDir: dir}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		locale  string
+		subject string
+	}{
+		{"fr", "Veuillez confirmer votre compte"},
+		{"de-AT", "Bitte bestätigen Sie Ihr Konto"},
+		{"it", "Conferma il tuo account"},
+		{"ja", "Please confirm your account"},
+		{"", "Please confirm your account"},
+	}
+	for _, test := range tests {
+		email, err := generator.Generate(TemplateConfirm, Recipient{Email: "alexandre@google.com", Locale: test.locale}, "http://localhost/confirm", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if email.Subject != test.subject {
+			t.Errorf("Expected the %q subject for the %q locale, got: %v", test.subject, test.locale, email.Subject)
+		}
+	}
+}
+
+func TestGenerateNotification(t *testing.T) {
+	generator, err := NewEmailGenerator(&config.App{Name: "MyApp", Theme: "flat"}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := map[string]string{"device": "Firefox", "ip": "203.0.113.7"}
+	email, err := generator.Generate(TemplateNewSignin, Recipient{Email: "alexandre@google.com"}, "http://localhost/revoke", details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(email.Text, "Device: Firefox") || !strings.Contains(email.Text, "IP address: 203.0.113.7") {
+		t.Errorf("Expected the sign in details in the email: %v", email.Text)
+	}
+	if strings.Contains(email.Text, "Country") {
+		t.Error("Expected no country without the country detail")
+	}
+	if !email.Unsubscribe {
+		t.Error("Expected the notifications to be unsubscribable")
+	}
+}
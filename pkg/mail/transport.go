@@ -0,0 +1,211 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	netmail "net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	gomail "gopkg.in/gomail.v2"
+)
+
+// Message is an email ready to be sent
+type Message struct {
+	From            string
+	FromName        string
+	To              string
+	ReplyTo         string
+	Subject         string
+	HTML            string
+	Text            string
+	ListUnsubscribe string
+}
+
+// from returns the From address, with its display name
+func (m Message) from() string {
+	if m.FromName == "" {
+		return m.From
+	}
+	return (&netmail.Address{Name: m.FromName, Address: m.From}).String()
+}
+
+// Transport sends the emails
+type Transport interface {
+	Send(message Message) error
+}
+
+// NewTransport creates the transport defined in the configuration
+// The emails sent by the smtp, sendmail and file transports are signed with DKIM when it is configured
+func NewTransport(config *config.Email) (Transport, error) {
+	switch config.Transport {
+	case "smtp", "sendmail", "file":
+		signer, err := newDKIMSigner(config)
+		if err != nil {
+			return nil, err
+		}
+		builder := &mimeBuilder{signer: signer}
+		switch config.Transport {
+		case "smtp":
+			return newSMTPTransport(config, builder)
+		case "sendmail":
+			return &sendmailTransport{path: config.SendmailPath, builder: builder}, nil
+		default:
+			return &fileTransport{dir: config.Dir, builder: builder}, nil
+		}
+	case "sendgrid", "mailgun", "postmark", "ses":
+		return newAPITransport(config)
+	default:
+		return nil, fmt.Errorf("unknown email transport: %s", config.Transport)
+	}
+}
+
+// mimeBuilder creates the MIME messages, signed when a DKIM signer is set
+type mimeBuilder struct {
+	signer *dkimSigner
+}
+
+// Build creates the MIME message: a multipart/alternative one when the message has a plain text version
+func (b *mimeBuilder) Build(message Message) ([]byte, error) {
+	m := gomail.NewMessage()
+	m.SetHeader("From", message.from())
+	m.SetHeader("To", message.To)
+	if message.ReplyTo != "" {
+		m.SetHeader("Reply-To", message.ReplyTo)
+	}
+	if message.ListUnsubscribe != "" {
+		m.SetHeader("List-Unsubscribe", message.ListUnsubscribe)
+	}
+	m.SetHeader("Subject", message.Subject)
+	m.SetHeader("Message-ID", messageID(message.From))
+	// The last part is the preferred one
+	if message.Text != "" {
+		m.SetBody("text/plain", message.Text)
+		m.AddAlternative("text/html", message.HTML)
+	} else {
+		m.SetBody("text/html", message.HTML)
+	}
+	var content bytes.Buffer
+	if _, err := m.WriteTo(&content); err != nil {
+		return nil, err
+	}
+	if b.signer == nil {
+		return content.Bytes(), nil
+	}
+	return b.signer.Sign(content.Bytes(), time.Now())
+}
+
+// messageID creates a unique Message-ID in the domain of the sender
+func messageID(from string) string {
+	suffix := make([]byte, 16)
+	rand.Read(suffix)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return "<" + strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(suffix) + "@" + domain + ">"
+}
+
+// rawMessage is an already built MIME message
+type rawMessage []byte
+
+func (m rawMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m)
+	return int64(n), err
+}
+
+// smtpTransport sends the emails to a SMTP server
+type smtpTransport struct {
+	dialer  *gomail.Dialer
+	builder *mimeBuilder
+}
+
+func newSMTPTransport(config *config.Email, builder *mimeBuilder) (*smtpTransport, error) {
+	dialer := &gomail.Dialer{Host: config.Host, Port: config.Port}
+	// Without credentials, the emails are sent without authentication
+	if config.Auth.User != "" {
+		dialer = gomail.NewPlainDialer(config.Host, config.Port, config.Auth.User, config.Auth.Pass)
+	}
+	switch config.TLS {
+	case "auto":
+		dialer.SSL = config.Port == 465
+	case "starttls":
+		dialer.SSL = false
+	case "tls":
+		dialer.SSL = true
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode: %s", config.TLS)
+	}
+	return &smtpTransport{dialer: dialer, builder: builder}, nil
+}
+
+func (t *smtpTransport) Send(message Message) error {
+	content, err := t.builder.Build(message)
+	if err != nil {
+		return err
+	}
+	s, err := t.dialer.Dial()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Send(message.From, []string{message.To}, rawMessage(content))
+}
+
+// sendmailTransport pipes the emails to a local sendmail binary
+type sendmailTransport struct {
+	path    string
+	builder *mimeBuilder
+}
+
+func (t *sendmailTransport) Send(message Message) error {
+	content, err := t.builder.Build(message)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(t.path, "-t", "-i")
+	cmd.Stdin = bytes.NewReader(content)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sendmail failed: %v: %s", err.Error(), output)
+	}
+	return nil
+}
+
+// fileTransport writes the emails to a maildir, used in development and tests
+type fileTransport struct {
+	dir     string
+	builder *mimeBuilder
+}
+
+func (t *fileTransport) Send(message Message) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+	content, err := t.builder.Build(message)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + hex.EncodeToString(suffix) + ".eml"
+	// The file is moved once written, so readers never see a partial email
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
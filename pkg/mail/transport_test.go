@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+var testMessage = Message{
+	From:     "noreply@app.com",
+	FromName: "My App",
+	To:       "alexandre@google.com",
+	ReplyTo:  "support@app.com",
+	Subject:  "Please confirm your account",
+	HTML:     "<p>Hello</p>",
+	Text:     "Hello",
+}
+
+func TestFileTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	transport, err := NewTransport(&config.Email{Transport: "file", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.Send(testMessage); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 email in the maildir, got: %v", len(files))
+	}
+	content, _ := ioutil.ReadFile(files[0])
+	for _, expected := range []string{"To: alexandre@google.com", `From: "My App" <noreply@app.com>`, "Reply-To: support@app.com", "multipart/alternative", "text/plain", "<p>Hello</p>"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %q in the email: %s", expected, content)
+		}
+	}
+	if strings.Contains(string(content), "List-Unsubscribe") {
+		t.Error("Expected no List-Unsubscribe header")
+	}
+}
+
+func TestAPITransports(t *testing.T) {
+	tests := []struct {
+		provider string
+		path     string
+		check    func(r *http.Request, body []byte) bool
+	}{
+		{"sendgrid", "/v3/mail/send", func(r *http.Request, body []byte) bool {
+			return r.Header.Get("Authorization") == "Bearer key" && strings.Contains(string(body), `"email":"alexandre@google.com"`) && strings.Contains(string(body), `"type":"text/plain"`)
+		}},
+		{"mailgun", "/v3/mg.app.com/messages", func(r *http.Request, body []byte) bool {
+			user, pass, _ := r.BasicAuth()
+			return user == "api" && pass == "key" && strings.Contains(string(body), "to=alexandre%40google.com") && strings.Contains(string(body), "text=Hello")
+		}},
+		{"postmark", "/email", func(r *http.Request, body []byte) bool {
+			var payload map[string]interface{}
+			json.Unmarshal(body, &payload)
+			return r.Header.Get("X-Postmark-Server-Token") == "key" && payload["HtmlBody"] == "<p>Hello</p>" && payload["ReplyTo"] == "support@app.com"
+		}},
+		{"ses", "/v2/email/outbound-emails", func(r *http.Request, body []byte) bool {
+			return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") && strings.Contains(string(body), `"ToAddresses":["alexandre@google.com"]`)
+		}},
+	}
+	for _, test := range tests {
+		var ok bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			ok = r.URL.Path == test.path && test.check(r, body)
+		}))
+		cfg := &config.Email{Transport: test.provider}
+		cfg.API.BaseURL = server.URL
+		cfg.API.Key = "key"
+		cfg.API.Secret = "secret"
+		cfg.API.Domain = "mg.app.com"
+		cfg.API.Region = "eu-west-1"
+		transport, err := NewTransport(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := transport.Send(testMessage); err != nil {
+			t.Errorf("%v: unexpected error: %v", test.provider, err)
+		}
+		if !ok {
+			t.Errorf("%v: unexpected request", test.provider)
+		}
+		server.Close()
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// Example of the AWS signature version 4 documentation
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("signV4() = %v, want %v", got, expected)
+	}
+}
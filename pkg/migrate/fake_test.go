@@ -0,0 +1,134 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeDatabase is a database/sql connector keeping the schema_migrations table in memory
+// The queries containing fail return an error, execs counts the executed statements
+type fakeDatabase struct {
+	mu      sync.Mutex
+	created bool
+	applied map[int64]time.Time
+	history []int64
+	execs   int
+	fail    string
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{applied: make(map[int64]time.Time)}
+}
+
+func (d *fakeDatabase) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+func (d *fakeDatabase) Driver() driver.Driver {
+	return fakeDriver{d}
+}
+
+type fakeDriver struct {
+	d *fakeDatabase
+}
+
+func (f fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{f.d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements aren't supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.fail != "" && strings.Contains(query, c.d.fail) {
+		return nil, errors.New("syntax error")
+	}
+	c.d.execs++
+	switch {
+	case strings.Contains(query, "CREATE TABLE IF NOT EXISTS") && strings.Contains(query, "schema_migrations"):
+		c.d.created = true
+	case strings.HasPrefix(query, "INSERT INTO") && strings.Contains(query, "schema_migrations"):
+		version := args[0].Value.(int64)
+		c.d.applied[version] = time.Now()
+		c.d.history = append(c.d.history, version)
+	case strings.HasPrefix(query, "DELETE FROM") && strings.Contains(query, "schema_migrations"):
+		version := args[0].Value.(int64)
+		delete(c.d.applied, version)
+		c.d.history = append(c.d.history, -version)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	switch {
+	case strings.Contains(query, "to_regclass"):
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{c.d.created}}}, nil
+	case strings.Contains(query, "MAX(version)"):
+		var max int64
+		for version := range c.d.applied {
+			if version > max {
+				max = version
+			}
+		}
+		return &fakeRows{columns: []string{"version"}, values: [][]driver.Value{{max}}}, nil
+	case strings.Contains(query, "SELECT version, applied_at"):
+		rows := &fakeRows{columns: []string{"version", "applied_at"}}
+		for version, appliedAt := range c.d.applied {
+			rows.values = append(rows.values, []driver.Value{version, appliedAt})
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,268 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/labstack/gommon/log"
+	"github.com/lib/pq"
+)
+
+// lockID is the key of the advisory lock preventing concurrent migrations
+const lockID = 4242424242
+
+// Status is the state of a migration on the database
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the migrations on the database
+type Migrator struct {
+	db     *sql.DB
+	config *config.DB
+	schema string
+	logger *log.Logger
+}
+
+// templateData is the data available in the migrations templates, Schema is already quoted
+// The other names must be quoted with the quoteIdent and quoteLiteral functions
+type templateData struct {
+	*config.DB
+	Schema string
+}
+
+// New creates a new Migrator
+func New(db *sql.DB, config *config.DB, logger *log.Logger) *Migrator {
+	return &Migrator{
+		db:     db,
+		config: config,
+		schema: pq.QuoteIdentifier(config.Schema),
+		logger: logger,
+	}
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up() error {
+	return m.migrate(func(conn *sql.Conn) error {
+		current, err := m.version(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if migration.Version <= current {
+				continue
+			}
+			m.logger.Infof("Applying migration %v_%v", migration.Version, migration.Name)
+			err := m.apply(conn, migration.Up, "INSERT INTO "+m.schema+".schema_migrations(version, name) VALUES($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %v_%v failed: %v", migration.Version, migration.Name, err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the provided number of applied migrations, starting from the last one
+func (m *Migrator) Down(steps int) error {
+	return m.migrate(func(conn *sql.Conn) error {
+		current, err := m.version(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			m.logger.Infof("Reverting migration %v_%v", migration.Version, migration.Name)
+			err := m.apply(conn, migration.Down, "DELETE FROM "+m.schema+".schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %v_%v revert failed: %v", migration.Version, migration.Name, err.Error())
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status returns the state of every migration, it doesn't change the database:
+// when the schema_migrations table doesn't exist yet, no migration is applied
+func (m *Migrator) Status() ([]Status, error) {
+	ctx := context.Background()
+	applied := make(map[int]time.Time)
+	var exists bool
+	err := m.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.schema+".schema_migrations").Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM "+m.schema+".schema_migrations")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var appliedAt time.Time
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				return nil, err
+			}
+			applied[version] = appliedAt
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	var statuses []Status
+	for _, migration := range migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the number of migrations which are not applied yet
+func (m *Migrator) Pending() (int, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a dedicated connection holding the migrations advisory lock,
+// so concurrent replicas wait for each other
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockID)
+	return fn(conn)
+}
+
+// migrate runs fn holding the migrations lock, after creating the schema and the schema_migrations table,
+// then gives the created objects to the configured owner
+func (m *Migrator) migrate(fn func(conn *sql.Conn) error) error {
+	return m.withLock(func(conn *sql.Conn) error {
+		query := "CREATE SCHEMA IF NOT EXISTS " + m.schema
+		if m.config.Owner != "" {
+			query += " AUTHORIZATION " + pq.QuoteIdentifier(m.config.Owner)
+		}
+		_, err := conn.ExecContext(context.Background(), query+`;
+		CREATE TABLE IF NOT EXISTS `+m.schema+`.schema_migrations (
+			version integer PRIMARY KEY NOT NULL,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		);`)
+		if err != nil {
+			return err
+		}
+		if err := fn(conn); err != nil {
+			return err
+		}
+		return m.transferOwnership(conn)
+	})
+}
+
+// transferOwnership gives the schema and every object it contains to the configured owner,
+// so the service can run with a login role owning only the auth schema while migrations run as an admin
+func (m *Migrator) transferOwnership(conn *sql.Conn) error {
+	if m.config.Owner == "" {
+		return nil
+	}
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf(`
+	ALTER SCHEMA %[1]s OWNER TO %[2]s;
+	DO
+	$body$
+	DECLARE
+		r record;
+	BEGIN
+		FOR r IN SELECT c.relname, c.relkind FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = %[3]s AND c.relkind IN ('r', 'v', 'S') LOOP
+			EXECUTE format('ALTER %%s %%I.%%I OWNER TO %%I',
+				CASE r.relkind WHEN 'r' THEN 'TABLE' WHEN 'v' THEN 'VIEW' ELSE 'SEQUENCE' END,
+				%[3]s, r.relname, %[4]s);
+		END LOOP;
+		FOR r IN SELECT p.oid::regprocedure AS signature FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE n.nspname = %[3]s LOOP
+			EXECUTE format('ALTER FUNCTION %%s OWNER TO %%I', r.signature, %[4]s);
+		END LOOP;
+	END
+	$body$;`, m.schema, pq.QuoteIdentifier(m.config.Owner), quoteLiteral(m.config.Schema), quoteLiteral(m.config.Owner)))
+	return err
+}
+
+// version returns the version of the last applied migration
+func (m *Migrator) version(conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(context.Background(), "SELECT COALESCE(MAX(version), 0) FROM "+m.schema+".schema_migrations").Scan(&version)
+	return version, err
+}
+
+// apply executes the migration template and records it in a single transaction
+func (m *Migrator) apply(conn *sql.Conn, migration string, record string, args ...interface{}) error {
+	query, err := m.render(migration)
+	if err != nil {
+		return err
+	}
+	m.logger.Debugf("Executing the following query: \n %v \n", query)
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// templateFuncs are the functions available in the migrations templates
+var templateFuncs = template.FuncMap{
+	"quoteIdent":   pq.QuoteIdentifier,
+	"quoteLiteral": quoteLiteral,
+}
+
+// render executes the migration template with the database configuration
+func (m *Migrator) render(migration string) (string, error) {
+	tmpl, err := template.New("sql").Funcs(templateFuncs).Parse(migration)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, templateData{DB: m.config, Schema: m.schema}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// quoteLiteral quotes a string literal
+func quoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
@@ -0,0 +1,131 @@
+package migrate
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/labstack/gommon/log"
+)
+
+func TestMigrations(t *testing.T) {
+	var dbConfig config.DB
+	dbConfig.Schema = "app1_auth"
+	dbConfig.Roles.Anonymous = "anonymous"
+	dbConfig.Roles.User = "normal_user"
+	m := New(nil, &dbConfig, nil)
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected migration %v to have version %v, got: %v", migration.Name, i+1, migration.Version)
+		}
+		for _, query := range []string{migration.Up, migration.Down} {
+			rendered, err := m.render(query)
+			if err != nil {
+				t.Errorf("Unable to render migration %v: %v", migration.Name, err)
+			}
+			if strings.Contains(rendered, "{{") || strings.Contains(rendered, "auth.") {
+				t.Errorf("Expected migration %v to be fully rendered in the configured schema, got: %v", migration.Name, rendered)
+			}
+		}
+	}
+}
+
+func TestMigrationsQuoting(t *testing.T) {
+	var dbConfig config.DB
+	dbConfig.Schema = "my-auth"
+	dbConfig.Roles.Anonymous = "web anon"
+	dbConfig.Roles.User = "o'user"
+	m := New(nil, &dbConfig, nil)
+
+	rendered, err := m.render(migrations[0].Up)
+	if err != nil {
+		t.Fatalf("Unable to render migration: %v", err)
+	}
+	for _, expected := range []string{`"my-auth".users`, `CREATE ROLE "web anon" NOLOGIN`, `rolname = 'o''user'`, `TO "web anon", "o'user";`} {
+		if !strings.Contains(rendered, expected) {
+			t.Errorf("Expected the rendered migration to contain %s, got: %v", expected, rendered)
+		}
+	}
+}
+
+func newTestMigrator(db *fakeDatabase) *Migrator {
+	var dbConfig config.DB
+	dbConfig.Schema = "auth"
+	logger := log.New("migrate")
+	logger.SetOutput(ioutil.Discard)
+	return New(sql.OpenDB(db), &dbConfig, logger)
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	db := newFakeDatabase()
+	m := newTestMigrator(db)
+	last := int64(len(migrations))
+
+	if pending, err := m.Pending(); err != nil || pending != len(migrations) {
+		t.Fatalf("Expected every migration to be pending, got: %v %v", pending, err)
+	}
+	if db.created || db.execs != 0 {
+		t.Fatalf("Expected the status not to change the database, got %v statements", db.execs)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, version := range db.history {
+		if version != int64(i+1) {
+			t.Fatalf("Expected the migrations to be applied in order, got: %v", db.history)
+		}
+	}
+	if pending, _ := m.Pending(); pending != 0 {
+		t.Errorf("Expected no pending migration, got: %v", pending)
+	}
+
+	db.history = nil
+	if err := m.Down(2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []int64{-last, -(last - 1)}; !reflect.DeepEqual(db.history, expected) {
+		t.Errorf("Expected the last migrations to be reverted, got: %v", db.history)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, status := range statuses {
+		if applied := status.AppliedAt != nil; applied != (int64(status.Version) < last-1) {
+			t.Errorf("Unexpected status of migration %v: applied %v", status.Version, applied)
+		}
+	}
+	if pending, _ := m.Pending(); pending != 2 {
+		t.Errorf("Expected 2 pending migrations, got: %v", pending)
+	}
+
+	db.history = nil
+	if err := m.Up(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []int64{last - 1, last}; !reflect.DeepEqual(db.history, expected) {
+		t.Errorf("Expected only the pending migrations to be applied, got: %v", db.history)
+	}
+}
+
+func TestMigratorUpFailure(t *testing.T) {
+	db := newFakeDatabase()
+	db.fail = "CREATE TABLE IF NOT EXISTS \"auth\".login_attempts"
+	m := newTestMigrator(db)
+
+	if err := m.Up(); err == nil || !strings.Contains(err.Error(), "create_login_attempts") {
+		t.Fatalf("Expected the create_login_attempts migration to fail, got: %v", err)
+	}
+	for _, migration := range migrations {
+		if migration.Name != "create_login_attempts" {
+			continue
+		}
+		if len(db.history) != migration.Version-1 {
+			t.Errorf("Expected the migrations to stop at the failing one, got: %v", db.history)
+		}
+	}
+}
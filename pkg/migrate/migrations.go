@@ -0,0 +1,778 @@
+package migrate
+
+// Migration is a versioned change of the database schema
+// Up and Down are templates executed with the database configuration, where .Schema is the quoted auth schema name
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrations is the ordered list of the schema migrations, new ones must be appended with the next version
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_users",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.users (
+			id uuid PRIMARY KEY NOT NULL,
+			email text UNIQUE NOT NULL UNIQUE,
+			password text NOT NULL,
+			confirmed boolean NOT NULL DEFAULT FALSE,
+			confirmToken uuid DEFAULT NULL,
+			resetPasswordToken text DEFAULT NULL
+		);
+		DO
+		$body$
+		BEGIN
+		IF NOT EXISTS (
+			SELECT
+			FROM pg_roles
+			WHERE rolname = {{ quoteLiteral .Roles.Anonymous }}) THEN
+			CREATE ROLE {{ quoteIdent .Roles.Anonymous }} NOLOGIN;
+		END IF;
+		END
+		$body$;
+		DO
+		$body$
+		BEGIN
+		IF NOT EXISTS (
+			SELECT
+			FROM pg_roles
+			WHERE rolname = {{ quoteLiteral .Roles.User }}) THEN
+			CREATE ROLE {{ quoteIdent .Roles.User }} NOLOGIN;
+		END IF;
+		END
+		$body$;
+		GRANT USAGE ON SCHEMA {{ .Schema }} TO {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.current_user_id() RETURNS uuid
+		LANGUAGE plpgsql
+		AS $$
+		BEGIN
+			RETURN current_setting('request.jwt.claim.userid', true)::uuid;
+		EXCEPTION
+			-- handle unrecognized configuration parameter error
+			WHEN undefined_object THEN RETURN '';
+		END;
+		$$;
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.current_user_id() TO {{ quoteIdent .Roles.User }};
+		`,
+		Down: `
+		DROP FUNCTION IF EXISTS {{ .Schema }}.current_user_id();
+		DROP TABLE IF EXISTS {{ .Schema }}.users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "create_login_attempts",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.login_attempts (
+			key text PRIMARY KEY NOT NULL,
+			failures integer NOT NULL DEFAULT 0,
+			last_failure timestamptz NOT NULL DEFAULT now(),
+			locked_until timestamptz DEFAULT NULL
+		);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS {{ .Schema }}.login_attempts;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "create_rate_limits",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.rate_limits (
+			key text PRIMARY KEY NOT NULL,
+			tokens double precision NOT NULL,
+			updated_at timestamptz NOT NULL DEFAULT now()
+		);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS {{ .Schema }}.rate_limits;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "create_identities",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.identities (
+			provider text NOT NULL,
+			subject text NOT NULL,
+			user_id uuid NOT NULL REFERENCES {{ .Schema }}.users(id) ON DELETE CASCADE,
+			PRIMARY KEY (provider, subject)
+		);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS {{ .Schema }}.identities;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "create_rpc_functions",
+		Up: `
+		CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.email_outbox (
+			id bigserial PRIMARY KEY,
+			kind text NOT NULL,
+			user_id uuid NOT NULL REFERENCES {{ .Schema }}.users(id) ON DELETE CASCADE,
+			attempts integer NOT NULL DEFAULT 0,
+			last_error text DEFAULT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			processed_at timestamptz DEFAULT NULL
+		);
+
+		DO
+		$body$
+		BEGIN
+		IF to_regtype({{ quoteLiteral (printf "%s.jwt" .Schema) }}) IS NULL THEN
+			CREATE TYPE {{ .Schema }}.jwt AS (token text);
+		END IF;
+		END
+		$body$;
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.base64url(data bytea) RETURNS text
+		LANGUAGE sql IMMUTABLE
+		AS $$
+			SELECT translate(encode(data, 'base64'), E'+/=\n', '-_');
+		$$;
+
+		-- sign creates a HS256 JWT, using the same claims layout as the service
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.sign(claims json, secret text) RETURNS text
+		LANGUAGE sql IMMUTABLE
+		SET search_path = {{ .Schema }}, public
+		AS $$
+			WITH header_and_payload AS (
+				SELECT base64url(convert_to('{"alg":"HS256","typ":"JWT"}', 'utf8')) || '.' || base64url(convert_to(claims::text, 'utf8')) AS data
+			)
+			SELECT data || '.' || base64url(hmac(data, secret, 'sha256')) FROM header_and_payload;
+		$$;
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.signup(email text, password text) RETURNS uuid
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			new_id uuid := gen_random_uuid();
+		BEGIN
+			IF signup.email IS NULL OR signup.email !~ '^[^@]+@[^@]+$' THEN
+				RAISE invalid_parameter_value USING MESSAGE = 'invalid email address';
+			END IF;
+			IF coalesce(signup.password, '') = '' THEN
+				RAISE invalid_parameter_value USING MESSAGE = 'invalid password';
+			END IF;
+			INSERT INTO users(id, email, password, confirmToken)
+				VALUES (new_id, signup.email, crypt(signup.password, gen_salt('bf', 12)), gen_random_uuid());
+			INSERT INTO email_outbox(kind, user_id) VALUES ('confirm', new_id);
+			RETURN new_id;
+		END;
+		$$;
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.login(email text, password text) RETURNS {{ .Schema }}.jwt
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			u users;
+			result jwt;
+		BEGIN
+			SELECT * INTO u FROM users WHERE users.email = login.email;
+			-- Only bcrypt hashes can be verified using pgcrypto
+			IF NOT FOUND OR u.password NOT LIKE '$2%' OR u.password <> crypt(login.password, u.password) THEN
+				RAISE invalid_password USING MESSAGE = 'invalid email or password';
+			END IF;
+			IF NOT u.confirmed THEN
+				RAISE insufficient_privilege USING MESSAGE = 'please confirm your account';
+			END IF;
+			result.token := sign(json_build_object(
+				'userid', u.id,
+				'email', u.email,
+				'role', {{ quoteLiteral .Roles.User }},
+				'exp', extract(epoch FROM now() + make_interval(hours => coalesce(nullif(current_setting('app.settings.jwt_exp', true), ''), '24')::int))::bigint
+			), current_setting('app.settings.jwt_secret'));
+			RETURN result;
+		END;
+		$$;
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.request_password_reset(email text) RETURNS void
+		LANGUAGE sql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+			INSERT INTO email_outbox(kind, user_id) SELECT 'reset', id FROM users WHERE users.email = request_password_reset.email;
+		$$;
+
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.signup(text, text) TO {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.login(text, text) TO {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.request_password_reset(text) TO {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		`,
+		Down: `
+		DROP FUNCTION IF EXISTS {{ .Schema }}.request_password_reset(text);
+		DROP FUNCTION IF EXISTS {{ .Schema }}.login(text, text);
+		DROP FUNCTION IF EXISTS {{ .Schema }}.signup(text, text);
+		DROP FUNCTION IF EXISTS {{ .Schema }}.sign(json, text);
+		DROP FUNCTION IF EXISTS {{ .Schema }}.base64url(bytea);
+		DROP TYPE IF EXISTS {{ .Schema }}.jwt;
+		DROP TABLE IF EXISTS {{ .Schema }}.email_outbox;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "create_events",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.events (
+			id bigserial PRIMARY KEY,
+			type text NOT NULL,
+			user_id uuid NOT NULL,
+			payload jsonb NOT NULL DEFAULT '{}',
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.record_user_event() RETURNS trigger
+		LANGUAGE plpgsql
+		AS $$
+		DECLARE
+			event_type text;
+			u record;
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				event_type := 'user.signed_up';
+				u := NEW;
+			ELSIF TG_OP = 'DELETE' THEN
+				event_type := 'user.deleted';
+				u := OLD;
+			ELSIF NOT OLD.confirmed AND NEW.confirmed THEN
+				event_type := 'user.confirmed';
+				u := NEW;
+			ELSIF OLD.resetPasswordToken IS NOT NULL AND NEW.resetPasswordToken IS NULL AND OLD.password <> NEW.password THEN
+				event_type := 'user.password_reset';
+				u := NEW;
+			ELSE
+				RETURN NULL;
+			END IF;
+			-- Serialize the event writers so the ids are committed in order and subscribers never skip an event
+			PERFORM pg_advisory_xact_lock(TG_RELID::bigint);
+			EXECUTE format('INSERT INTO %I.events(type, user_id, payload) VALUES ($1, $2, $3)', TG_TABLE_SCHEMA)
+				USING event_type, u.id, jsonb_build_object('id', u.id, 'email', u.email, 'confirmed', u.confirmed);
+			RETURN NULL;
+		END;
+		$$;
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.notify_event() RETURNS trigger
+		LANGUAGE plpgsql
+		AS $$
+		BEGIN
+			PERFORM pg_notify(TG_TABLE_SCHEMA || '_events', NEW.id::text);
+			RETURN NULL;
+		END;
+		$$;
+
+		DROP TRIGGER IF EXISTS record_user_event ON {{ .Schema }}.users;
+		CREATE TRIGGER record_user_event AFTER INSERT OR UPDATE OR DELETE ON {{ .Schema }}.users
+			FOR EACH ROW EXECUTE PROCEDURE {{ .Schema }}.record_user_event();
+
+		DROP TRIGGER IF EXISTS notify_event ON {{ .Schema }}.events;
+		CREATE TRIGGER notify_event AFTER INSERT ON {{ .Schema }}.events
+			FOR EACH ROW EXECUTE PROCEDURE {{ .Schema }}.notify_event();
+		`,
+		Down: `
+		DROP TRIGGER IF EXISTS record_user_event ON {{ .Schema }}.users;
+		DROP FUNCTION IF EXISTS {{ .Schema }}.record_user_event();
+		DROP FUNCTION IF EXISTS {{ .Schema }}.notify_event() CASCADE;
+		DROP TABLE IF EXISTS {{ .Schema }}.events;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "create_webhook_deliveries",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.webhook_deliveries (
+			id bigserial PRIMARY KEY,
+			endpoint text NOT NULL,
+			event text NOT NULL,
+			payload jsonb NOT NULL,
+			status text NOT NULL DEFAULT 'pending',
+			attempts integer NOT NULL DEFAULT 0,
+			last_error text DEFAULT NULL,
+			next_attempt_at timestamptz NOT NULL DEFAULT now(),
+			delivered_at timestamptz DEFAULT NULL,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON {{ .Schema }}.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.webhook_cursor (
+			event_id bigint NOT NULL
+		);
+		-- Only the events recorded after the webhooks are installed are relayed
+		INSERT INTO {{ .Schema }}.webhook_cursor(event_id)
+			SELECT coalesce(max(id), 0) FROM {{ .Schema }}.events
+			WHERE NOT EXISTS (SELECT FROM {{ .Schema }}.webhook_cursor);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS {{ .Schema }}.webhook_cursor;
+		DROP TABLE IF EXISTS {{ .Schema }}.webhook_deliveries;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add_users_metadata",
+		Up: `
+		ALTER TABLE {{ .Schema }}.users ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
+		`,
+		Down: `
+		ALTER TABLE {{ .Schema }}.users DROP COLUMN IF EXISTS metadata;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "create_email_queue",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.email_queue (
+			id bigserial PRIMARY KEY,
+			recipient text NOT NULL,
+			subject text NOT NULL,
+			content text NOT NULL,
+			status text NOT NULL DEFAULT 'pending',
+			attempts integer NOT NULL DEFAULT 0,
+			last_error text DEFAULT NULL,
+			next_attempt_at timestamptz NOT NULL DEFAULT now(),
+			sent_at timestamptz DEFAULT NULL,
+			created_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS email_queue_pending_idx ON {{ .Schema }}.email_queue (next_attempt_at) WHERE status = 'pending';
+		`,
+		Down: `
+		DROP TABLE IF EXISTS {{ .Schema }}.email_queue;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "add_users_locale",
+		Up: `
+		ALTER TABLE {{ .Schema }}.users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
+		`,
+		Down: `
+		ALTER TABLE {{ .Schema }}.users DROP COLUMN IF EXISTS locale;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "add_email_queue_text",
+		Up: `
+		ALTER TABLE {{ .Schema }}.email_queue ADD COLUMN IF NOT EXISTS text_content text NOT NULL DEFAULT '';
+		ALTER TABLE {{ .Schema }}.email_queue ADD COLUMN IF NOT EXISTS unsubscribe boolean NOT NULL DEFAULT false;
+		`,
+		Down: `
+		ALTER TABLE {{ .Schema }}.email_queue DROP COLUMN IF EXISTS unsubscribe;
+		ALTER TABLE {{ .Schema }}.email_queue DROP COLUMN IF EXISTS text_content;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "hash_confirm_tokens",
+		Up: `
+		ALTER TABLE {{ .Schema }}.users ALTER COLUMN confirmToken TYPE text USING encode(digest(confirmToken::text, 'sha256'), 'hex');
+		ALTER TABLE {{ .Schema }}.users ADD COLUMN IF NOT EXISTS confirmTokenExpiresAt timestamptz DEFAULT NULL;
+		UPDATE {{ .Schema }}.users SET confirmTokenExpiresAt = now() + interval '24 hours' WHERE confirmToken IS NOT NULL;
+
+		-- The confirmation token is created by the service when it sends the email of the outbox
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.signup(email text, password text) RETURNS uuid
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			new_id uuid := gen_random_uuid();
+		BEGIN
+			IF signup.email IS NULL OR signup.email !~ '^[^@]+@[^@]+$' THEN
+				RAISE invalid_parameter_value USING MESSAGE = 'invalid email address';
+			END IF;
+			IF coalesce(signup.password, '') = '' THEN
+				RAISE invalid_parameter_value USING MESSAGE = 'invalid password';
+			END IF;
+			INSERT INTO users(id, email, password)
+				VALUES (new_id, signup.email, crypt(signup.password, gen_salt('bf', 12)));
+			INSERT INTO email_outbox(kind, user_id) VALUES ('confirm', new_id);
+			RETURN new_id;
+		END;
+		$$;
+		`,
+		Down: `
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.signup(email text, password text) RETURNS uuid
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			new_id uuid := gen_random_uuid();
+		BEGIN
+			IF signup.email IS NULL OR signup.email !~ '^[^@]+@[^@]+$' THEN
+				RAISE invalid_parameter_value USING MESSAGE = 'invalid email address';
+			END IF;
+			IF coalesce(signup.password, '') = '' THEN
+				RAISE invalid_parameter_value USING MESSAGE = 'invalid password';
+			END IF;
+			INSERT INTO users(id, email, password, confirmToken)
+				VALUES (new_id, signup.email, crypt(signup.password, gen_salt('bf', 12)), gen_random_uuid());
+			INSERT INTO email_outbox(kind, user_id) VALUES ('confirm', new_id);
+			RETURN new_id;
+		END;
+		$$;
+		ALTER TABLE {{ .Schema }}.users DROP COLUMN IF EXISTS confirmTokenExpiresAt;
+		-- The hashed tokens can't be restored, the pending confirmations get a new token
+		ALTER TABLE {{ .Schema }}.users ALTER COLUMN confirmToken TYPE uuid USING CASE WHEN confirmToken IS NULL THEN NULL ELSE gen_random_uuid() END;
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "create_known_devices",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.known_devices (
+			user_id uuid NOT NULL REFERENCES {{ .Schema }}.users(id) ON DELETE CASCADE,
+			fingerprint text NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			last_seen_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (user_id, fingerprint)
+		);
+		ALTER TABLE {{ .Schema }}.users ADD COLUMN IF NOT EXISTS tokensRevokedAt timestamptz DEFAULT NULL;
+
+		-- check_token rejects the tokens issued before the sessions of the user were revoked
+		-- It is meant to be used as the db-pre-request function of PostgREST
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.check_token() RETURNS void
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			revoked_at timestamptz;
+		BEGIN
+			IF coalesce(current_setting('request.jwt.claim.userid', true), '') = '' THEN
+				RETURN;
+			END IF;
+			SELECT tokensRevokedAt INTO revoked_at FROM users WHERE id = current_setting('request.jwt.claim.userid', true)::uuid;
+			IF revoked_at IS NOT NULL AND coalesce(nullif(current_setting('request.jwt.claim.iat', true), '')::bigint, 0) < extract(epoch FROM revoked_at) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the token has been revoked';
+			END IF;
+		END;
+		$$;
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.check_token() TO {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		`,
+		Down: `
+		DROP FUNCTION IF EXISTS {{ .Schema }}.check_token();
+		ALTER TABLE {{ .Schema }}.users DROP COLUMN IF EXISTS tokensRevokedAt;
+		DROP TABLE IF EXISTS {{ .Schema }}.known_devices;
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "create_sessions",
+		Up: `
+		CREATE TABLE IF NOT EXISTS {{ .Schema }}.sessions (
+			id uuid PRIMARY KEY,
+			user_id uuid NOT NULL REFERENCES {{ .Schema }}.users(id) ON DELETE CASCADE,
+			user_agent text NOT NULL DEFAULT '',
+			ip text NOT NULL DEFAULT '',
+			refresh_token_family uuid UNIQUE NOT NULL,
+			refresh_token_hash text NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			last_seen_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON {{ .Schema }}.sessions (user_id);
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.current_session_id() RETURNS uuid
+		LANGUAGE sql STABLE
+		AS $$
+			SELECT nullif(current_setting('request.jwt.claim.session_id', true), '')::uuid;
+		$$;
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.current_session_id() TO {{ quoteIdent .Roles.User }};
+
+		-- check_token also rejects the tokens of the deleted sessions
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.check_token() RETURNS void
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			revoked_at timestamptz;
+		BEGIN
+			IF coalesce(current_setting('request.jwt.claim.userid', true), '') = '' THEN
+				RETURN;
+			END IF;
+			SELECT tokensRevokedAt INTO revoked_at FROM users WHERE id = current_setting('request.jwt.claim.userid', true)::uuid;
+			IF revoked_at IS NOT NULL AND coalesce(nullif(current_setting('request.jwt.claim.iat', true), '')::bigint, 0) < extract(epoch FROM revoked_at) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the token has been revoked';
+			END IF;
+			IF current_session_id() IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sessions WHERE id = current_session_id()) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the session has been revoked';
+			END IF;
+		END;
+		$$;
+		`,
+		Down: `
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.check_token() RETURNS void
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			revoked_at timestamptz;
+		BEGIN
+			IF coalesce(current_setting('request.jwt.claim.userid', true), '') = '' THEN
+				RETURN;
+			END IF;
+			SELECT tokensRevokedAt INTO revoked_at FROM users WHERE id = current_setting('request.jwt.claim.userid', true)::uuid;
+			IF revoked_at IS NOT NULL AND coalesce(nullif(current_setting('request.jwt.claim.iat', true), '')::bigint, 0) < extract(epoch FROM revoked_at) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the token has been revoked';
+			END IF;
+		END;
+		$$;
+		DROP FUNCTION IF EXISTS {{ .Schema }}.current_session_id();
+		DROP TABLE IF EXISTS {{ .Schema }}.sessions;
+		`,
+	},
+	{
+		Version: 15,
+		Name:    "add_anonymous_users",
+		Up: `
+		ALTER TABLE {{ .Schema }}.users ADD COLUMN IF NOT EXISTS anonymous boolean NOT NULL DEFAULT FALSE;
+		ALTER TABLE {{ .Schema }}.users ALTER COLUMN email DROP NOT NULL;
+
+		-- The anonymous users only sign up when they get an email
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.record_user_event() RETURNS trigger
+		LANGUAGE plpgsql
+		AS $$
+		DECLARE
+			event_type text;
+			u record;
+		BEGIN
+			IF TG_OP = 'INSERT' AND NOT NEW.anonymous THEN
+				event_type := 'user.signed_up';
+				u := NEW;
+			ELSIF TG_OP = 'INSERT' THEN
+				RETURN NULL;
+			ELSIF TG_OP = 'DELETE' AND OLD.email IS NOT NULL THEN
+				event_type := 'user.deleted';
+				u := OLD;
+			ELSIF TG_OP = 'DELETE' THEN
+				RETURN NULL;
+			ELSIF OLD.email IS NULL AND NEW.email IS NOT NULL THEN
+				-- An anonymous user signed up
+				event_type := 'user.signed_up';
+				u := NEW;
+			ELSIF NOT OLD.confirmed AND NEW.confirmed THEN
+				event_type := 'user.confirmed';
+				u := NEW;
+			ELSIF OLD.resetPasswordToken IS NOT NULL AND NEW.resetPasswordToken IS NULL AND OLD.password <> NEW.password THEN
+				event_type := 'user.password_reset';
+				u := NEW;
+			ELSE
+				RETURN NULL;
+			END IF;
+			-- Serialize the event writers so the ids are committed in order and subscribers never skip an event
+			PERFORM pg_advisory_xact_lock(TG_RELID::bigint);
+			EXECUTE format('INSERT INTO %I.events(type, user_id, payload) VALUES ($1, $2, $3)', TG_TABLE_SCHEMA)
+				USING event_type, u.id, jsonb_build_object('id', u.id, 'email', u.email, 'confirmed', u.confirmed);
+			RETURN NULL;
+		END;
+		$$;
+		`,
+		Down: `
+		DELETE FROM {{ .Schema }}.users WHERE email IS NULL;
+		ALTER TABLE {{ .Schema }}.users ALTER COLUMN email SET NOT NULL;
+		ALTER TABLE {{ .Schema }}.users DROP COLUMN IF EXISTS anonymous;
+
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.record_user_event() RETURNS trigger
+		LANGUAGE plpgsql
+		AS $$
+		DECLARE
+			event_type text;
+			u record;
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				event_type := 'user.signed_up';
+				u := NEW;
+			ELSIF TG_OP = 'DELETE' THEN
+				event_type := 'user.deleted';
+				u := OLD;
+			ELSIF NOT OLD.confirmed AND NEW.confirmed THEN
+				event_type := 'user.confirmed';
+				u := NEW;
+			ELSIF OLD.resetPasswordToken IS NOT NULL AND NEW.resetPasswordToken IS NULL AND OLD.password <> NEW.password THEN
+				event_type := 'user.password_reset';
+				u := NEW;
+			ELSE
+				RETURN NULL;
+			END IF;
+			-- Serialize the event writers so the ids are committed in order and subscribers never skip an event
+			PERFORM pg_advisory_xact_lock(TG_RELID::bigint);
+			EXECUTE format('INSERT INTO %I.events(type, user_id, payload) VALUES ($1, $2, $3)', TG_TABLE_SCHEMA)
+				USING event_type, u.id, jsonb_build_object('id', u.id, 'email', u.email, 'confirmed', u.confirmed);
+			RETURN NULL;
+		END;
+		$$;
+		`,
+	},
+	{
+		Version: 16,
+		Name:    "add_login_sessions",
+		Up: `
+		-- login records a session without refresh token, so the token can be signed out and is checked by check_token
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.login(email text, password text) RETURNS {{ .Schema }}.jwt
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			u users;
+			result jwt;
+			new_session_id uuid := gen_random_uuid();
+			token_expiry interval := make_interval(hours => coalesce(nullif(current_setting('app.settings.jwt_exp', true), ''), '24')::int);
+		BEGIN
+			SELECT * INTO u FROM users WHERE users.email = login.email;
+			-- Only bcrypt hashes can be verified using pgcrypto
+			IF NOT FOUND OR u.password NOT LIKE '$2%' OR u.password <> crypt(login.password, u.password) THEN
+				RAISE invalid_password USING MESSAGE = 'invalid email or password';
+			END IF;
+			IF NOT u.confirmed THEN
+				RAISE insufficient_privilege USING MESSAGE = 'please confirm your account';
+			END IF;
+			-- The sessions of the previous logins are removed once their token expired
+			DELETE FROM sessions WHERE user_id = u.id AND refresh_token_hash = '' AND created_at < now() - token_expiry;
+			INSERT INTO sessions(id, user_id, refresh_token_family, refresh_token_hash) VALUES (new_session_id, u.id, gen_random_uuid(), '');
+			result.token := sign(json_build_object(
+				'userid', u.id,
+				'email', u.email,
+				'role', {{ quoteLiteral .Roles.User }},
+				'session_id', new_session_id,
+				'iat', extract(epoch FROM now())::bigint,
+				'exp', extract(epoch FROM now() + token_expiry)::bigint
+			), current_setting('app.settings.jwt_secret'));
+			RETURN result;
+		END;
+		$$;
+		`,
+		Down: `
+		DELETE FROM {{ .Schema }}.sessions WHERE refresh_token_hash = '';
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.login(email text, password text) RETURNS {{ .Schema }}.jwt
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			u users;
+			result jwt;
+		BEGIN
+			SELECT * INTO u FROM users WHERE users.email = login.email;
+			-- Only bcrypt hashes can be verified using pgcrypto
+			IF NOT FOUND OR u.password NOT LIKE '$2%' OR u.password <> crypt(login.password, u.password) THEN
+				RAISE invalid_password USING MESSAGE = 'invalid email or password';
+			END IF;
+			IF NOT u.confirmed THEN
+				RAISE insufficient_privilege USING MESSAGE = 'please confirm your account';
+			END IF;
+			result.token := sign(json_build_object(
+				'userid', u.id,
+				'email', u.email,
+				'role', {{ quoteLiteral .Roles.User }},
+				'exp', extract(epoch FROM now() + make_interval(hours => coalesce(nullif(current_setting('app.settings.jwt_exp', true), ''), '24')::int))::bigint
+			), current_setting('app.settings.jwt_secret'));
+			RETURN result;
+		END;
+		$$;
+		`,
+	},
+	{
+		Version: 17,
+		Name:    "add_sessions_previous_refresh_token",
+		Up: `
+		ALTER TABLE {{ .Schema }}.sessions ADD COLUMN IF NOT EXISTS previous_refresh_token_hash text DEFAULT NULL;
+		ALTER TABLE {{ .Schema }}.sessions ADD COLUMN IF NOT EXISTS rotated_at timestamptz DEFAULT NULL;
+		`,
+		Down: `
+		ALTER TABLE {{ .Schema }}.sessions DROP COLUMN IF EXISTS rotated_at;
+		ALTER TABLE {{ .Schema }}.sessions DROP COLUMN IF EXISTS previous_refresh_token_hash;
+		`,
+	},
+	{
+		Version: 18,
+		Name:    "add_rate_limits_refilled_at",
+		Up: `
+		ALTER TABLE {{ .Schema }}.rate_limits ADD COLUMN IF NOT EXISTS refilled_at timestamptz NOT NULL DEFAULT now();
+		CREATE INDEX IF NOT EXISTS rate_limits_refilled_at_idx ON {{ .Schema }}.rate_limits (refilled_at);
+		`,
+		Down: `
+		ALTER TABLE {{ .Schema }}.rate_limits DROP COLUMN IF EXISTS refilled_at;
+		`,
+	},
+	{
+		Version: 19,
+		Name:    "revoke_rpc_functions",
+		Up: `
+		REVOKE EXECUTE ON FUNCTION {{ .Schema }}.signup(text, text) FROM PUBLIC, {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		REVOKE EXECUTE ON FUNCTION {{ .Schema }}.login(text, text) FROM PUBLIC, {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		REVOKE EXECUTE ON FUNCTION {{ .Schema }}.request_password_reset(text) FROM PUBLIC, {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		`,
+		Down: `
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.signup(text, text) TO PUBLIC, {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.login(text, text) TO PUBLIC, {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		GRANT EXECUTE ON FUNCTION {{ .Schema }}.request_password_reset(text) TO PUBLIC, {{ quoteIdent .Roles.Anonymous }}, {{ quoteIdent .Roles.User }};
+		`,
+	},
+	{
+		Version: 20,
+		Name:    "clear_sent_emails_content",
+		Up: `
+		UPDATE {{ .Schema }}.email_queue SET content = '', text_content = '' WHERE status = 'sent';
+		`,
+		Down: `
+		-- The content of the sent emails can't be restored
+		`,
+	},
+	{
+		Version: 21,
+		Name:    "add_users_banned_until",
+		Up: `
+		ALTER TABLE {{ .Schema }}.users ADD COLUMN IF NOT EXISTS bannedUntil timestamptz DEFAULT NULL;
+
+		-- check_token also rejects the tokens of the banned users
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.check_token() RETURNS void
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			revoked_at timestamptz;
+		BEGIN
+			IF coalesce(current_setting('request.jwt.claim.userid', true), '') = '' THEN
+				RETURN;
+			END IF;
+			SELECT tokensRevokedAt INTO revoked_at FROM users WHERE id = current_setting('request.jwt.claim.userid', true)::uuid;
+			IF revoked_at IS NOT NULL AND coalesce(nullif(current_setting('request.jwt.claim.iat', true), '')::bigint, 0) < extract(epoch FROM revoked_at) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the token has been revoked';
+			END IF;
+			IF EXISTS (SELECT 1 FROM users WHERE id = current_setting('request.jwt.claim.userid', true)::uuid AND bannedUntil > now()) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the user is banned';
+			END IF;
+			IF current_session_id() IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sessions WHERE id = current_session_id()) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the session has been revoked';
+			END IF;
+		END;
+		$$;
+		`,
+		Down: `
+		CREATE OR REPLACE FUNCTION {{ .Schema }}.check_token() RETURNS void
+		LANGUAGE plpgsql SECURITY DEFINER
+		SET search_path = {{ .Schema }}, public
+		AS $$
+		DECLARE
+			revoked_at timestamptz;
+		BEGIN
+			IF coalesce(current_setting('request.jwt.claim.userid', true), '') = '' THEN
+				RETURN;
+			END IF;
+			SELECT tokensRevokedAt INTO revoked_at FROM users WHERE id = current_setting('request.jwt.claim.userid', true)::uuid;
+			IF revoked_at IS NOT NULL AND coalesce(nullif(current_setting('request.jwt.claim.iat', true), '')::bigint, 0) < extract(epoch FROM revoked_at) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the token has been revoked';
+			END IF;
+			IF current_session_id() IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sessions WHERE id = current_session_id()) THEN
+				RAISE insufficient_privilege USING MESSAGE = 'the session has been revoked';
+			END IF;
+		END;
+		$$;
+		ALTER TABLE {{ .Schema }}.users DROP COLUMN IF EXISTS bannedUntil;
+		`,
+	},
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// RememberDevice records a device the user signed in from, identified by its fingerprint
+// It returns true when the user signed in before, but never from this device
+func (u *User) RememberDevice(db *sql.DB, fingerprint string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var known, first bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM "+Table("known_devices")+" WHERE user_id = $1 AND fingerprint = $2), NOT EXISTS(SELECT 1 FROM "+Table("known_devices")+" WHERE user_id = $1)", u.ID, fingerprint).Scan(&known, &first)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("INSERT INTO "+Table("known_devices")+"(user_id, fingerprint) VALUES($1, $2) ON CONFLICT (user_id, fingerprint) DO UPDATE SET last_seen_at = now()", u.ID, fingerprint)
+	if err != nil {
+		return false, err
+	}
+	return !known && !first, tx.Commit()
+}
+
+// RevokeTokens revokes the tokens issued to the user until now, and deletes its sessions
+// The check_token SQL function rejects them
+func (u *User) RevokeTokens(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE "+Table("users")+" SET tokensRevokedAt = now() WHERE id = $1", u.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+Table("sessions")+" WHERE user_id = $1", u.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TokensRevoked checks if the tokens issued to the user at the given unix time were revoked, or if the user was deleted or banned
+func (u *User) TokensRevoked(db *sql.DB, issuedAt int64) (bool, error) {
+	if _, err := uuid.FromString(u.ID); err != nil {
+		return true, nil
+	}
+	var revoked bool
+	err := db.QueryRow("SELECT coalesce(extract(epoch FROM tokensRevokedAt) > $2, false) OR coalesce(bannedUntil > now(), false) FROM "+Table("users")+" WHERE id = $1", u.ID, issuedAt).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return revoked, err
+}
+
+// Ban bans the user until the given time, and deletes its sessions
+// It returns sql.ErrNoRows when the user doesn't exist
+func (u *User) Ban(db *sql.DB, until time.Time) error {
+	if _, err := uuid.FromString(u.ID); err != nil {
+		return sql.ErrNoRows
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("UPDATE "+Table("users")+" SET bannedUntil = $2 WHERE id = $1", u.ID, until)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+Table("sessions")+" WHERE user_id = $1", u.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Unban lifts the ban of the user
+// It returns sql.ErrNoRows when the user doesn't exist
+func (u *User) Unban(db *sql.DB) error {
+	if _, err := uuid.FromString(u.ID); err != nil {
+		return sql.ErrNoRows
+	}
+	result, err := db.Exec("UPDATE "+Table("users")+" SET bannedUntil = NULL WHERE id = $1", u.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		err = sql.ErrNoRows
+	}
+	return err
+}
+
+// Banned checks if the user is currently banned
+func (u *User) Banned(db *sql.DB) (bool, error) {
+	var banned bool
+	err := db.QueryRow("SELECT coalesce(bannedUntil > now(), false) FROM "+Table("users")+" WHERE id = $1", u.ID).Scan(&banned)
+	return banned, err
+}
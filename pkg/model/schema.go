@@ -0,0 +1,16 @@
+package model
+
+import "github.com/lib/pq"
+
+// schema is the quoted name of the schema containing the auth tables
+var schema = pq.QuoteIdentifier("auth")
+
+// SetSchema sets the name of the schema containing the auth tables
+func SetSchema(name string) {
+	schema = pq.QuoteIdentifier(name)
+}
+
+// Table returns the quoted, schema-qualified name of an auth table
+func Table(name string) string {
+	return schema + "." + name
+}
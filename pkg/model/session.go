@@ -0,0 +1,178 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or was already used
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Session represents a signed in device of a user
+// Its refresh tokens belong to the same family, and are rotated at every use
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// newRefreshToken creates a refresh token of the family, it returns the token and the hash to store
+// The family prefixes the token so a reused token can be traced back to its session
+func newRefreshToken(family string) (string, string) {
+	secret := uuid.NewV4().String()
+	return family + "." + secret, hashToken(secret)
+}
+
+// parseRefreshToken splits a refresh token into its family and its secret
+func parseRefreshToken(refreshToken string) (string, string, error) {
+	parts := strings.SplitN(refreshToken, ".", 2)
+	if len(parts) != 2 {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if _, err := uuid.FromString(parts[0]); err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	return parts[0], parts[1], nil
+}
+
+// CreateSession records a new session of the user, and returns its first refresh token
+func CreateSession(db *sql.DB, userID, userAgent, ip string) (*Session, string, error) {
+	family := uuid.NewV4().String()
+	refreshToken, hash := newRefreshToken(family)
+	s := &Session{ID: uuid.NewV4().String(), UserID: userID, UserAgent: userAgent, IP: ip}
+	err := db.QueryRow("INSERT INTO "+Table("sessions")+"(id, user_id, user_agent, ip, refresh_token_family, refresh_token_hash) VALUES($1, $2, $3, $4, $5, $6) RETURNING created_at, last_seen_at",
+		s.ID, s.UserID, s.UserAgent, s.IP, family, hash).Scan(&s.CreatedAt, &s.LastSeenAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return s, refreshToken, nil
+}
+
+// RefreshSession exchanges a refresh token for a new one of the same family
+// Using an already used token deletes the session, as the token was probably stolen
+// The previous token is still accepted during the reuse interval, as concurrent requests may use it:
+// the session is then returned without new refresh token, the one of the first request stays valid
+// Sessions unused for longer than the expiry are deleted
+func RefreshSession(db *sql.DB, refreshToken string, expiry, reuseInterval time.Duration) (*Session, string, error) {
+	family, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var s Session
+	var hash string
+	var previousHash sql.NullString
+	var rotatedAt pq.NullTime
+	err = tx.QueryRow("SELECT id, user_id, user_agent, ip, created_at, last_seen_at, refresh_token_hash, previous_refresh_token_hash, rotated_at FROM "+Table("sessions")+" WHERE refresh_token_family = $1 FOR UPDATE", family).
+		Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &hash, &previousHash, &rotatedAt)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	submittedHash := hashToken(secret)
+	expired := time.Since(s.LastSeenAt) > expiry
+	if !expired && submittedHash != hash && submittedHash == previousHash.String && time.Since(rotatedAt.Time) <= reuseInterval {
+		// A concurrent request has just rotated the token
+		return &s, "", tx.Commit()
+	}
+	if expired || submittedHash != hash {
+		if _, err := tx.Exec("DELETE FROM "+Table("sessions")+" WHERE id = $1", s.ID); err != nil {
+			return nil, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	refreshToken, hash = newRefreshToken(family)
+	err = tx.QueryRow("UPDATE "+Table("sessions")+" SET previous_refresh_token_hash = refresh_token_hash, refresh_token_hash = $1, rotated_at = now(), last_seen_at = now() WHERE id = $2 RETURNING last_seen_at", hash, s.ID).Scan(&s.LastSeenAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return &s, refreshToken, tx.Commit()
+}
+
+// EndSession deletes the session of a refresh token, when the token is its current one
+func EndSession(db *sql.DB, refreshToken string) error {
+	family, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec("DELETE FROM "+Table("sessions")+" WHERE refresh_token_family = $1 AND refresh_token_hash = $2", family, hashToken(secret))
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// ListSessions returns the sessions of the user used during the expiry, the most recently used first
+func ListSessions(db *sql.DB, userID string, expiry time.Duration) ([]Session, error) {
+	rows, err := db.Query("SELECT id, user_id, user_agent, ip, created_at, last_seen_at FROM "+Table("sessions")+" WHERE user_id = $1 AND last_seen_at > $2 ORDER BY last_seen_at DESC", userID, time.Now().Add(-expiry))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession deletes a session of the user, it returns sql.ErrNoRows when the user has no such session
+func DeleteSession(db *sql.DB, userID, id string) error {
+	if _, err := uuid.FromString(id); err != nil {
+		return sql.ErrNoRows
+	}
+	res, err := db.Exec("DELETE FROM "+Table("sessions")+" WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SessionExists checks if the session wasn't deleted
+func SessionExists(db *sql.DB, id string) (bool, error) {
+	if _, err := uuid.FromString(id); err != nil {
+		return false, nil
+	}
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM "+Table("sessions")+" WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
@@ -1,46 +1,154 @@
 package model
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"math/rand"
 	"strings"
 	"time"
 
+	"github.com/alexandrevilain/postgrest-auth/pkg/password"
 	"github.com/dchest/passwordreset"
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lib/pq"
 	uuid "github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents a user of our auth system
 type User struct {
-	ID                 string `json:"id"`
-	Email              string `json:"email"`
-	Password           string `json:"password"`
-	Confirmed          bool
-	ConfirmToken       sql.NullString
-	ResetPasswordToken sql.NullString
+	ID                    string `json:"id"`
+	Email                 string `json:"email"`
+	Password              string `json:"password"`
+	Confirmed             bool
+	ConfirmToken          sql.NullString
+	ConfirmTokenExpiresAt pq.NullTime
+	ResetPasswordToken    sql.NullString
+	Metadata              map[string]interface{} `json:"metadata"`
+	Locale                string                 `json:"locale"`
+	Anonymous             bool                   `json:"-"`
+}
+
+// userColumns are the columns loaded by the Find methods
+// The anonymous users have no email
+const userColumns = "id, coalesce(email, ''), password, confirmed, confirmToken, confirmTokenExpiresAt, resetPasswordToken, metadata, locale, anonymous"
+
+// Identity represents an account of an external provider linked to a user
+type Identity struct {
+	Provider string
+	Subject  string
 }
 
 // FindByEmail allows us to find a user by its email (used for authentication)
 func (u *User) FindByEmail(db *sql.DB) error {
-	return db.QueryRow("SELECT id, password, confirmed, confirmToken, resetPasswordToken FROM auth.users WHERE email = $1", u.Email).Scan(&u.ID, &u.Password, &u.Confirmed, &u.ConfirmToken, &u.ResetPasswordToken)
+	return u.scan(db.QueryRow("SELECT "+userColumns+" FROM "+Table("users")+" WHERE email = $1", u.Email))
 }
 
 // FindByID allows us to find a user by its id (used for authentication)
 func (u *User) FindByID(db *sql.DB) error {
-	return db.QueryRow("SELECT email, password, confirmed, confirmToken, resetPasswordToken FROM auth.users WHERE id = $1", u.ID).Scan(&u.Email, &u.Password, &u.Confirmed, &u.ConfirmToken, &u.ResetPasswordToken)
+	return u.scan(db.QueryRow("SELECT "+userColumns+" FROM "+Table("users")+" WHERE id = $1", u.ID))
+}
+
+// FindByIdentity allows us to find a user by one of its linked provider accounts
+func (u *User) FindByIdentity(db *sql.DB, identity Identity) error {
+	return u.scan(db.QueryRow("SELECT "+userColumns+" FROM "+Table("users")+" JOIN "+Table("identities")+" ON user_id = id WHERE provider = $1 AND subject = $2", identity.Provider, identity.Subject))
+}
+
+// scan loads the user from a row of the userColumns
+func (u *User) scan(row *sql.Row) error {
+	var metadata []byte
+	if err := row.Scan(&u.ID, &u.Email, &u.Password, &u.Confirmed, &u.ConfirmToken, &u.ConfirmTokenExpiresAt, &u.ResetPasswordToken, &metadata, &u.Locale, &u.Anonymous); err != nil {
+		return err
+	}
+	return json.Unmarshal(metadata, &u.Metadata)
+}
+
+// LinkIdentity links a provider account to the user
+func (u *User) LinkIdentity(db *sql.DB, identity Identity) error {
+	_, err := db.Exec("INSERT INTO "+Table("identities")+"(provider, subject, user_id) VALUES($1, $2, $3) ON CONFLICT DO NOTHING", identity.Provider, identity.Subject, u.ID)
+	return err
 }
 
 // Create allow us to create new user in database
+// The confirmation token is created when the confirmation email is sent
 func (u *User) Create(db *sql.DB) error {
 	u.ID = uuid.NewV4().String()
-	u.ConfirmToken = sql.NullString{String: uuid.NewV4().String(), Valid: true}
-	return db.QueryRow("INSERT INTO auth.users(id, email, password, confirmToken) VALUES($1, $2, $3, $4) RETURNING id", u.ID, u.Email, u.Password, u.ConfirmToken).Scan(&u.ID)
+	if u.Metadata == nil {
+		u.Metadata = map[string]interface{}{}
+	}
+	metadata, err := json.Marshal(u.Metadata)
+	if err != nil {
+		return err
+	}
+	return db.QueryRow("INSERT INTO "+Table("users")+"(id, email, password, metadata, locale) VALUES($1, $2, $3, $4, $5) RETURNING id", u.ID, u.Email, u.Password, string(metadata), u.Locale).Scan(&u.ID)
+}
+
+// CreateAnonymous creates a placeholder user without email nor password, for the visitors who didn't sign up yet
+func (u *User) CreateAnonymous(db *sql.DB) error {
+	u.ID = uuid.NewV4().String()
+	u.Anonymous = true
+	u.Metadata = map[string]interface{}{}
+	_, err := db.Exec("INSERT INTO "+Table("users")+"(id, password, locale, anonymous) VALUES($1, '', $2, true)", u.ID, u.Locale)
+	return err
+}
+
+// Upgrade gives its email and password to an anonymous user, keeping its id so the data it created stays its own
+// The user stays anonymous until its email is confirmed, unless it was verified by a provider
+// It returns sql.ErrNoRows when the user isn't anonymous anymore
+func (u *User) Upgrade(db *sql.DB, verified bool) error {
+	if u.Metadata == nil {
+		u.Metadata = map[string]interface{}{}
+	}
+	metadata, err := json.Marshal(u.Metadata)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec("UPDATE "+Table("users")+" SET email = $1, password = $2, metadata = $3, locale = $4, anonymous = $5 WHERE id = $6 AND anonymous", u.Email, u.Password, string(metadata), u.Locale, !verified, u.ID)
+	if err != nil {
+		return err
+	}
+	upgraded, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if upgraded == 0 {
+		return sql.ErrNoRows
+	}
+	u.Anonymous = !verified
+	return nil
+}
+
+// Import inserts an existing user, keeping its id, password hash and confirmation status, and links its identities
+// When dryRun is true, the changes are rolled back so only the errors are reported
+func (u *User) Import(db *sql.DB, identities []Identity, dryRun bool) error {
+	if u.ID == "" {
+		u.ID = uuid.NewV4().String()
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO "+Table("users")+"(id, email, password, confirmed) VALUES($1, $2, $3, $4)", u.ID, u.Email, u.Password, u.Confirmed)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		_, err = tx.Exec("INSERT INTO "+Table("identities")+"(provider, subject, user_id) VALUES($1, $2, $3)", identity.Provider, identity.Subject, u.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	return tx.Commit()
 }
 
 // GeneratePassword generate random password
-func (u *User) CreateRandomPassword(length int) error {
+func (u *User) CreateRandomPassword(hasher password.Hasher, length int) error {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	seededRand := rand.New(
 		rand.NewSource(time.Now().UnixNano()))
@@ -49,13 +157,13 @@ func (u *User) CreateRandomPassword(length int) error {
 		b[i] = charset[seededRand.Intn(len(charset))]
 	}
 	u.Password = string(b)
-	return u.HashPassword()
+	return u.HashPassword(hasher)
 }
 
 // CreateResetToken create a random reset token
 func (u *User) CreateResetToken(db *sql.DB, secret string) error {
 	u.ResetPasswordToken = sql.NullString{String: passwordreset.NewToken(u.Email, 1*time.Hour, []byte(u.Password), []byte(secret)), Valid: true}
-	_, err := db.Query("UPDATE auth.users SET resetPasswordToken = $1 WHERE id = $2", u.ResetPasswordToken, u.ID)
+	_, err := db.Exec("UPDATE "+Table("users")+" SET resetPasswordToken = $1 WHERE id = $2", u.ResetPasswordToken, u.ID)
 	return err
 }
 
@@ -75,35 +183,80 @@ func (u *User) ValidateResetToken(db *sql.DB, secret, token string) error {
 }
 
 // UpdatePassword edits the user's password in memory and in db
-func (u *User) UpdatePassword(db *sql.DB, password string) error {
+func (u *User) UpdatePassword(db *sql.DB, hasher password.Hasher, password string) error {
+	u.Password = password
+	if err := u.HashPassword(hasher); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE "+Table("users")+" SET password = $1 WHERE id = $2 ", u.Password, u.ID)
+	return err
+}
+
+// ResetPassword edits the user's password and consumes its reset token
+func (u *User) ResetPassword(db *sql.DB, hasher password.Hasher, password string) error {
 	u.Password = password
-	u.HashPassword()
-	_, err := db.Query("UPDATE auth.users SET password = $1 WHERE id = $2 ", u.Password, u.ID)
+	if err := u.HashPassword(hasher); err != nil {
+		return err
+	}
+	u.ResetPasswordToken = sql.NullString{Valid: false}
+	_, err := db.Exec("UPDATE "+Table("users")+" SET password = $1, resetPasswordToken = $2 WHERE id = $3", u.Password, u.ResetPasswordToken, u.ID)
 	return err
 }
 
+// CreateConfirmToken creates a confirmation token valid for the provided duration, replacing the previous one
+// Only its hash is stored, the returned token is the one to send to the user
+func (u *User) CreateConfirmToken(db *sql.DB, validity time.Duration) (string, error) {
+	token := uuid.NewV4().String()
+	u.ConfirmToken = sql.NullString{String: hashToken(token), Valid: true}
+	u.ConfirmTokenExpiresAt = pq.NullTime{Time: time.Now().Add(validity), Valid: true}
+	_, err := db.Exec("UPDATE "+Table("users")+" SET confirmToken = $1, confirmTokenExpiresAt = $2 WHERE id = $3", u.ConfirmToken, u.ConfirmTokenExpiresAt, u.ID)
+	return token, err
+}
+
+// CheckConfirmToken checks if the token matches the user's confirmation token
+// The second returned value tells if the token has expired
+func (u *User) CheckConfirmToken(token string) (bool, bool) {
+	if !u.ConfirmToken.Valid || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(u.ConfirmToken.String)) != 1 {
+		return false, false
+	}
+	return true, u.ConfirmTokenExpiresAt.Valid && time.Now().After(u.ConfirmTokenExpiresAt.Time)
+}
+
+// hashToken returns the hex encoded sha256 hash of a token
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 // UpdateStatus edits the user's confirmation status
 func (u *User) UpdateStatus(db *sql.DB, confirm bool) error {
 	u.Confirmed = confirm
 	u.ConfirmToken = sql.NullString{Valid: false}
-	_, err := db.Query("UPDATE auth.users SET confirmed = $1, confirmToken = $2 WHERE id = $3", u.Confirmed, u.ConfirmToken, u.ID)
+	u.ConfirmTokenExpiresAt = pq.NullTime{Valid: false}
+	// Confirming its email completes the upgrade of an anonymous user
+	u.Anonymous = u.Anonymous && !confirm
+	_, err := db.Exec("UPDATE "+Table("users")+" SET confirmed = $1, confirmToken = $2, confirmTokenExpiresAt = $3, anonymous = $4 WHERE id = $5", u.Confirmed, u.ConfirmToken, u.ConfirmTokenExpiresAt, u.Anonymous, u.ID)
 	return err
 }
 
-// HashPassword hashes the user's password using bcrypt
-func (u *User) HashPassword() error {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(u.Password), 14)
+// HashPassword hashes the user's password using the provided hasher
+func (u *User) HashPassword(hasher password.Hasher) error {
+	hash, err := hasher.Hash(u.Password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(bytes)
+	u.Password = hash
 	return nil
 }
 
 // CheckPassword checks if the provided password matches the actual user's password hash
-func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+// The second returned value tells if the hash is outdated and should be upgraded
+func (u *User) CheckPassword(hasher password.Hasher, password string) (bool, bool) {
+	ok, rehash, err := hasher.Verify(password, u.Password)
+	if err != nil {
+		return false, false
+	}
+	return ok, rehash
 }
 
 // CheckEmailDomain checks if the user's email address matches the provied domains list
@@ -124,15 +277,21 @@ func (u *User) CheckEmailDomain(domains []string) bool {
 	return false
 }
 
-// CreateJWTToken creates a new JWT token for the user
-func (u *User) CreateJWTToken(role, secret string, exp int) (string, error) {
+// CreateJWTToken creates a new JWT token for the user's session
+// The extra claims can't override the userid, email, role, session_id, iat and exp claims
+func (u *User) CreateJWTToken(role, secret, sessionID string, exp int, extra map[string]interface{}) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	// Create a map to store our claims
 	claims := token.Claims.(jwt.MapClaims)
+	for name, value := range extra {
+		claims[name] = value
+	}
 	claims["userid"] = u.ID
 	claims["email"] = u.Email
 	claims["role"] = role
+	claims["session_id"] = sessionID
+	claims["iat"] = time.Now().Unix()
 	claims["exp"] = time.Now().Add(time.Hour * time.Duration(exp)).Unix()
 
 	tokenString, err := token.SignedString([]byte(secret))
@@ -145,7 +304,8 @@ func (u *User) CreateJWTToken(role, secret string, exp int) (string, error) {
 // GetMapRepresentation return the json representation of the user without secret informations
 func (u *User) GetMapRepresentation() map[string]interface{} {
 	return map[string]interface{}{
-		"id":    u.ID,
-		"email": u.Email,
+		"id":        u.ID,
+		"email":     u.Email,
+		"anonymous": u.Anonymous,
 	}
 }
@@ -1,6 +1,12 @@
 package model
 
-import "testing"
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
 
 func TestCheckEmailDomain(t *testing.T) {
 	tests := []struct {
@@ -26,3 +32,32 @@ func TestCheckEmailDomain(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckConfirmToken(t *testing.T) {
+	tests := []struct {
+		token   string
+		expires time.Time
+		valid   bool
+		expired bool
+	}{
+		{"4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", time.Now().Add(time.Hour), true, false},
+		{"4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6", time.Now().Add(-time.Hour), true, true},
+		{"00000000-0000-0000-0000-000000000000", time.Now().Add(time.Hour), false, false},
+	}
+	for _, test := range tests {
+		u := User{
+			ConfirmToken:          sql.NullString{String: hashToken("4b3c9d9e-bc31-4a3f-a0d5-b0a4a2b4b9a6"), Valid: true},
+			ConfirmTokenExpiresAt: pq.NullTime{Time: test.expires, Valid: true},
+		}
+		valid, expired := u.CheckConfirmToken(test.token)
+		if valid != test.valid || expired != test.expired {
+			t.Errorf("Expected %v check to be (%v, %v), got: (%v, %v)", test.token, test.valid, test.expired, valid, expired)
+		}
+	}
+
+	// Confirmed users have no token
+	u := User{Confirmed: true}
+	if valid, _ := u.CheckConfirmToken(""); valid {
+		t.Error("Expected an empty token to be invalid")
+	}
+}
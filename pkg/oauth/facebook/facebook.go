@@ -31,27 +31,30 @@ func New() oauth.Provider {
 }
 
 // GetUserInfo retrive facebook user info based on the token provided
-func (provider *facebookProvider) GetUserInfo(payload *oauth.Oauth2Payload, oauthStateString string) (model.User, error) {
+func (provider *facebookProvider) GetUserInfo(payload *oauth.Oauth2Payload, oauthStateString string) (model.User, model.Identity, error) {
 	var facebookUser Facebookuser
 	var user model.User
+	var identity model.Identity
 	if payload.State != oauthStateString {
-		return user, fmt.Errorf("invalid oauth state")
+		return user, identity, fmt.Errorf("invalid oauth state")
 	}
-	response, err := http.Get(fmt.Sprintf("https://graph.facebook.com/me?fields=email&access_token=%v", payload.Token))
+	response, err := http.Get(fmt.Sprintf("https://graph.facebook.com/me?fields=id,email&access_token=%v", payload.Token))
 	if err != nil {
-		return user, fmt.Errorf("failed getting user info: %s", err.Error())
+		return user, identity, fmt.Errorf("failed getting user info: %s", err.Error())
 	}
 	defer response.Body.Close()
 	content, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return user, fmt.Errorf("failed reading response body: %s", err.Error())
+		return user, identity, fmt.Errorf("failed reading response body: %s", err.Error())
 	}
 
 	if err := json.Unmarshal(content, &facebookUser); err != nil {
-		return user, fmt.Errorf("An error occurred, maybe your haven't check the right scopes  %s", err.Error())
+		return user, identity, fmt.Errorf("An error occurred, maybe your haven't check the right scopes  %s", err.Error())
 	}
 	user.Email = facebookUser.Email
 	user.Confirmed = true
+	identity.Provider = "facebook"
+	identity.Subject = facebookUser.ID
 
-	return user, nil
+	return user, identity, nil
 }
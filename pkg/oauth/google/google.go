@@ -23,6 +23,7 @@ type Googleuser struct {
 	FamilyName    string `json:"family_name"`
 	Link          string `json:"link"`
 	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
 }
 
 // New init provider with the googleProvider struct
@@ -31,28 +32,32 @@ func New() oauth.Provider {
 }
 
 // GetUserInfo retrive google user infos based on the token provided
-func (provider *googleProvider) GetUserInfo(payload *oauth.Oauth2Payload, oauthStateString string) (model.User, error) {
+func (provider *googleProvider) GetUserInfo(payload *oauth.Oauth2Payload, oauthStateString string) (model.User, model.Identity, error) {
 	var googleUser Googleuser
 	var user model.User
+	var identity model.Identity
 	if payload.State != oauthStateString {
-		return user, fmt.Errorf("invalid oauth state")
+		return user, identity, fmt.Errorf("invalid oauth state")
 	}
 	response, err := http.Get(fmt.Sprintf("https://www.googleapis.com/oauth2/v2/userinfo?access_token=%v", payload.Token))
 	if err != nil {
-		return user, fmt.Errorf("failed getting user info: %s", err.Error())
+		return user, identity, fmt.Errorf("failed getting user info: %s", err.Error())
 	}
 	defer response.Body.Close()
 	content, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return user, fmt.Errorf("failed reading response body: %s", err.Error())
+		return user, identity, fmt.Errorf("failed reading response body: %s", err.Error())
 	}
 
 	if err := json.Unmarshal(content, &googleUser); err != nil {
-		return user, fmt.Errorf("An error occurred, maybe your haven't check the right scopes  %s", err.Error())
+		return user, identity, fmt.Errorf("An error occurred, maybe your haven't check the right scopes  %s", err.Error())
 	}
 
 	user.Email = googleUser.Email
 	user.Confirmed = googleUser.VerifiedEmail
+	user.Locale = googleUser.Locale
+	identity.Provider = "google"
+	identity.Subject = googleUser.ID
 
-	return user, nil
+	return user, identity, nil
 }
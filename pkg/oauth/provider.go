@@ -12,5 +12,5 @@ type Oauth2Payload struct {
 
 //Provider give you all providers functions for oauth2
 type Provider interface {
-	GetUserInfo(payload *Oauth2Payload, oauthStateString string) (model.User, error)
+	GetUserInfo(payload *Oauth2Payload, oauthStateString string) (model.User, model.Identity, error)
 }
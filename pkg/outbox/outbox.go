@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// maxAttempts is the number of times a message is processed before being abandoned
+const maxAttempts = 5
+
+// Message is a side effect requested by a SQL function, for instance an email to send
+type Message struct {
+	ID     int64
+	Kind   string
+	UserID string
+}
+
+// Handler processes a message of the outbox
+type Handler func(message Message) error
+
+// Worker polls the outbox table and processes the pending messages
+type Worker struct {
+	db       *sql.DB
+	table    string
+	handler  Handler
+	interval time.Duration
+	quitChan chan bool
+	logger   *log.Logger
+}
+
+// NewWorker creates, and returns a new Worker object polling the provided table.
+func NewWorker(db *sql.DB, table string, handler Handler, interval time.Duration, logger *log.Logger) *Worker {
+	return &Worker{
+		db:       db,
+		table:    table,
+		handler:  handler,
+		interval: interval,
+		quitChan: make(chan bool),
+		logger:   logger,
+	}
+}
+
+// Start launches the worker by starting a goroutine
+func (w *Worker) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.poll(); err != nil {
+					w.logger.Errorf("An error occurred while polling the outbox: %v \n", err.Error())
+				}
+			case <-w.quitChan:
+				w.logger.Info("Stopping outbox worker ...\n")
+				return
+			}
+		}
+	}()
+}
+
+// Stop tells the worker to stop polling the outbox.
+func (w *Worker) Stop() {
+	go func() {
+		w.quitChan <- true
+	}()
+}
+
+// poll processes the pending messages, locking them so concurrent replicas skip them
+func (w *Worker) poll() error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, kind, user_id FROM "+w.table+" WHERE processed_at IS NULL AND attempts < $1 ORDER BY id LIMIT 10 FOR UPDATE SKIP LOCKED", maxAttempts)
+	if err != nil {
+		return err
+	}
+	var messages []Message
+	for rows.Next() {
+		var message Message
+		if err := rows.Scan(&message.ID, &message.Kind, &message.UserID); err != nil {
+			rows.Close()
+			return err
+		}
+		messages = append(messages, message)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if handlerErr := w.handler(message); handlerErr != nil {
+			w.logger.Errorf("An error occurred while processing outbox message %v: %v \n", message.ID, handlerErr.Error())
+			_, err = tx.Exec("UPDATE "+w.table+" SET attempts = attempts + 1, last_error = $1 WHERE id = $2", handlerErr.Error(), message.ID)
+		} else {
+			_, err = tx.Exec("UPDATE "+w.table+" SET processed_at = now() WHERE id = $1", message.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,172 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Corpus is a list of passwords known to have appeared in data breaches
+type Corpus interface {
+	Contains(password string) (bool, error)
+}
+
+// OpenCorpus opens the breached passwords corpus stored at the provided path
+// A directory is read as Have I Been Pwned range files, a file as a bloom filter
+func OpenCorpus(path string) (Corpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &rangeCorpus{dir: path}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBloomFilter(f)
+}
+
+// sha1Hex returns the uppercase hex-encoded SHA-1 hash of the password, as used by Have I Been Pwned
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// rangeCorpus reads Have I Been Pwned k-anonymity range files from a directory
+// Each file is named by a 5 characters hash prefix and contains "<hash suffix>:<count>" lines,
+// which is the format returned by the https://api.pwnedpasswords.com/range/<prefix> api
+type rangeCorpus struct {
+	dir string
+}
+
+func (c *rangeCorpus) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.EqualFold(strings.SplitN(line, ":", 2)[0], suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// bloomMagic is the header of the bloom filter files
+const bloomMagic = "PGABLOOM"
+
+// BloomFilter is a probabilistic set of SHA-1 password hashes
+// It's stored as the magic header, the number of bits and the number of hash functions (big endian uint64),
+// followed by the bits array
+type BloomFilter struct {
+	bits   []byte
+	m      uint64
+	hashes uint64
+}
+
+// NewBloomFilter creates an empty bloom filter of m bits using the provided number of hash functions
+func NewBloomFilter(m, hashes uint64) *BloomFilter {
+	return &BloomFilter{
+		bits:   make([]byte, (m+7)/8),
+		m:      m,
+		hashes: hashes,
+	}
+}
+
+// ReadBloomFilter reads a bloom filter written by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, len(bloomMagic)+16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed reading bloom filter header: %s", err.Error())
+	}
+	if string(header[:len(bloomMagic)]) != bloomMagic {
+		return nil, errors.New("invalid bloom filter file")
+	}
+	m := binary.BigEndian.Uint64(header[len(bloomMagic):])
+	hashes := binary.BigEndian.Uint64(header[len(bloomMagic)+8:])
+	if m == 0 || hashes == 0 {
+		return nil, errors.New("invalid bloom filter file")
+	}
+	f := NewBloomFilter(m, hashes)
+	if _, err := io.ReadFull(r, f.bits); err != nil {
+		return nil, fmt.Errorf("failed reading bloom filter: %s", err.Error())
+	}
+	return f, nil
+}
+
+// WriteTo writes the bloom filter so it can be loaded with ReadBloomFilter
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomMagic)+16)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint64(header[len(bloomMagic):], f.m)
+	binary.BigEndian.PutUint64(header[len(bloomMagic)+8:], f.hashes)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	n2, err := w.Write(f.bits)
+	return int64(n + n2), err
+}
+
+// Add adds the hex-encoded SHA-1 hash of a password to the filter
+func (f *BloomFilter) Add(hash string) error {
+	indexes, err := f.indexes(hash)
+	if err != nil {
+		return err
+	}
+	for _, i := range indexes {
+		f.bits[i/8] |= 1 << (i % 8)
+	}
+	return nil
+}
+
+// Contains checks if the password may be in the filter
+func (f *BloomFilter) Contains(password string) (bool, error) {
+	indexes, err := f.indexes(sha1Hex(password))
+	if err != nil {
+		return false, err
+	}
+	for _, i := range indexes {
+		if f.bits[i/8]&(1<<(i%8)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// indexes computes the bits of the hash using double hashing on the SHA-1 digest
+func (f *BloomFilter) indexes(hash string) ([]uint64, error) {
+	sum, err := hex.DecodeString(hash)
+	if err != nil || len(sum) != sha1.Size {
+		return nil, fmt.Errorf("invalid SHA-1 hash: %s", hash)
+	}
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16])
+	indexes := make([]uint64, f.hashes)
+	for i := range indexes {
+		indexes[i] = (h1 + uint64(i)*h2) % f.m
+	}
+	return indexes, nil
+}
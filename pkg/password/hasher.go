@@ -0,0 +1,264 @@
+package password
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrUnknownFormat is returned when a hash is not stored in a supported format
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// ErrTooLong is returned when a password is too long to be hashed using bcrypt
+var ErrTooLong = errors.New("password too long for bcrypt")
+
+// BcryptMaxLength is the maximum length (in bytes) of the passwords hashed using bcrypt, which ignores the next bytes
+const BcryptMaxLength = 72
+
+const (
+	saltLength = 16
+	keyLength  = 32
+	// maxMemory (in KiB) and maxPasses bound the cost of the stored hashes, whatever their algorithm
+	maxMemory = 1 << 21
+	maxPasses = 100
+)
+
+// Hasher hashes passwords and verifies them against stored hashes
+type Hasher interface {
+	// Hash hashes the password using the configured algorithm
+	Hash(password string) (string, error)
+	// Verify checks the password against a hash stored in any supported format
+	// When the password matches, rehash tells if the hash is outdated and should be replaced
+	Verify(password, encoded string) (ok bool, rehash bool, err error)
+}
+
+// NewHasher creates a new Hasher using the configured algorithm
+func NewHasher(config *config.Hash) (Hasher, error) {
+	switch config.Algorithm {
+	case "argon2id", "scrypt", "bcrypt":
+		return &hasher{config: config}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm: %s", config.Algorithm)
+	}
+}
+
+// hasher stores hashes using the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//	$scrypt$ln=15,r=8,p=1$<salt>$<hash>
+//
+// bcrypt hashes keep their own $2a$, $2b$ or $2y$ format
+type hasher struct {
+	config *config.Hash
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	switch h.config.Algorithm {
+	case "bcrypt":
+		if len(password) > BcryptMaxLength {
+			return "", ErrTooLong
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		return string(hash), err
+	case "scrypt":
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		params := scryptParams{logN: h.config.ScryptLogN, r: h.config.ScryptR, p: h.config.ScryptP}
+		key, err := scrypt.Key([]byte(password), salt, 1<<uint(params.logN), params.r, params.p, keyLength)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", params.logN, params.r, params.p, encode(salt), encode(key)), nil
+	default:
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.config.Argon2Time, h.config.Argon2Memory, h.config.Argon2Threads, keyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.config.Argon2Memory, h.config.Argon2Time, h.config.Argon2Threads, encode(salt), encode(key)), nil
+	}
+}
+
+func (h *hasher) Verify(password, encoded string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return true, h.config.Algorithm != "bcrypt" || cost != h.config.BcryptCost, err
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.verifyArgon2(password, encoded)
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return h.verifyScrypt(password, encoded)
+	case strings.HasPrefix(encoded, "$firebase-scrypt$"):
+		ok, err := verifyFirebaseScrypt(password, encoded)
+		return ok, true, err
+	default:
+		return false, false, ErrUnknownFormat
+	}
+}
+
+func (h *hasher) verifyArgon2(password, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownFormat
+	}
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrUnknownFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || time > maxPasses || threads == 0 || memory < 8*uint32(threads) || memory > maxMemory {
+		return false, false, ErrUnknownFormat
+	}
+	salt, key, err := decodeSaltAndKey(parts[4], parts[5])
+	if err != nil {
+		return false, false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false, nil
+	}
+	rehash := h.config.Algorithm != "argon2id" || memory != h.config.Argon2Memory || time != h.config.Argon2Time || threads != h.config.Argon2Threads
+	return true, rehash, nil
+}
+
+type scryptParams struct {
+	logN, r, p int
+}
+
+// bounded checks that the parameters are valid and within the cost limits: scrypt uses 128*r*N bytes of memory,
+// and p runs it p times
+func (params scryptParams) bounded() bool {
+	return params.logN > 0 && params.logN <= 30 && params.r > 0 && params.r <= maxMemory && params.p > 0 && params.p <= maxPasses &&
+		uint64(params.r)<<uint(params.logN)/8 <= maxMemory
+}
+
+func (h *hasher) verifyScrypt(password, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, false, ErrUnknownFormat
+	}
+	var params scryptParams
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.logN, &params.r, &params.p); err != nil || !params.bounded() {
+		return false, false, ErrUnknownFormat
+	}
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return false, false, err
+	}
+	computed, err := scrypt.Key([]byte(password), salt, 1<<uint(params.logN), params.r, params.p, len(key))
+	if err != nil {
+		return false, false, err
+	}
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false, nil
+	}
+	rehash := h.config.Algorithm != "scrypt" || params != scryptParams{logN: h.config.ScryptLogN, r: h.config.ScryptR, p: h.config.ScryptP}
+	return true, rehash, nil
+}
+
+// Supported checks if the hash is stored in a format that can be verified
+func Supported(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2id$", "$scrypt$", "$firebase-scrypt$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirebaseScryptHash encodes a hash exported from Firebase Authentication, which uses a modified scrypt
+// The project-wide parameters are base64-encoded as shown in the Firebase console, and stored in the hash:
+//
+//	$firebase-scrypt$r=<rounds>,m=<mem cost>$<salt separator>$<signer key>$<salt>$<hash>
+//
+// Those hashes can only be verified, they are upgraded to the configured algorithm on sign in
+func FirebaseScryptHash(signerKey, saltSeparator string, rounds, memCost int, salt, hash string) (string, error) {
+	var values []string
+	for _, value := range []string{saltSeparator, signerKey, salt, hash} {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid firebase scrypt parameter: %s", err.Error())
+		}
+		values = append(values, encode(decoded))
+	}
+	return fmt.Sprintf("$firebase-scrypt$r=%d,m=%d$%s", rounds, memCost, strings.Join(values, "$")), nil
+}
+
+// verifyFirebaseScrypt verifies a Firebase modified scrypt hash: the signer key is encrypted using AES-256-CTR
+// with the scrypt key of the password and the salt followed by the salt separator
+func verifyFirebaseScrypt(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 7 {
+		return false, ErrUnknownFormat
+	}
+	var rounds, memCost int
+	if _, err := fmt.Sscanf(parts[2], "r=%d,m=%d", &rounds, &memCost); err != nil || !(scryptParams{logN: memCost, r: rounds, p: 1}).bounded() {
+		return false, ErrUnknownFormat
+	}
+	var values [][]byte
+	for _, part := range parts[3:] {
+		value, err := base64.RawStdEncoding.DecodeString(part)
+		if err != nil {
+			return false, ErrUnknownFormat
+		}
+		values = append(values, value)
+	}
+	saltSeparator, signerKey, salt, hash := values[0], values[1], values[2], values[3]
+
+	key, err := scrypt.Key([]byte(password), append(salt, saltSeparator...), 1<<uint(memCost), rounds, 1, keyLength)
+	if err != nil {
+		return false, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false, err
+	}
+	computed := make([]byte, len(signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(computed, signerKey)
+	return subtle.ConstantTimeCompare(computed, hash) == 1, nil
+}
+
+// newSalt generates a random salt
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLength)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+// encode encodes bytes using the unpadded base64 encoding of the PHC string format
+func encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+// decodeSaltAndKey decodes the salt and the key of a PHC string
+func decodeSaltAndKey(encodedSalt, encodedKey string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, ErrUnknownFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) == 0 {
+		return nil, nil, ErrUnknownFormat
+	}
+	return salt, key, nil
+}
@@ -0,0 +1,132 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+func testHashConfig(algorithm string) *config.Hash {
+	return &config.Hash{
+		Algorithm:     algorithm,
+		BcryptCost:    4,
+		Argon2Memory:  1024,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+		ScryptLogN:    10,
+		ScryptR:       8,
+		ScryptP:       1,
+	}
+}
+
+func TestHasher(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		prefix    string
+	}{
+		{"argon2id", "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{"scrypt", "$scrypt$ln=10,r=8,p=1$"},
+		{"bcrypt", "$2a$04$"},
+	}
+	for _, test := range tests {
+		hasher, err := NewHasher(testHashConfig(test.algorithm))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		hash, err := hasher.Hash("Tr0ub4dor&3")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(hash, test.prefix) {
+			t.Errorf("Expected %v hash to start with %v, got: %v", test.algorithm, test.prefix, hash)
+		}
+		ok, rehash, err := hasher.Verify("Tr0ub4dor&3", hash)
+		if !ok || rehash || err != nil {
+			t.Errorf("Expected %v hash to match without rehash, got: %v %v %v", test.algorithm, ok, rehash, err)
+		}
+		ok, _, err = hasher.Verify("password", hash)
+		if ok || err != nil {
+			t.Errorf("Expected %v hash not to match another password, got: %v %v", test.algorithm, ok, err)
+		}
+	}
+}
+
+func TestHasherRehash(t *testing.T) {
+	bcryptHasher, _ := NewHasher(testHashConfig("bcrypt"))
+	hash, _ := bcryptHasher.Hash("Tr0ub4dor&3")
+
+	argon2Config := testHashConfig("argon2id")
+	argon2Hasher, _ := NewHasher(argon2Config)
+	ok, rehash, err := argon2Hasher.Verify("Tr0ub4dor&3", hash)
+	if !ok || !rehash || err != nil {
+		t.Errorf("Expected bcrypt hash to be upgraded, got: %v %v %v", ok, rehash, err)
+	}
+
+	hash, _ = argon2Hasher.Hash("Tr0ub4dor&3")
+	argon2Config.Argon2Time = 2
+	ok, rehash, err = argon2Hasher.Verify("Tr0ub4dor&3", hash)
+	if !ok || !rehash || err != nil {
+		t.Errorf("Expected outdated argon2id hash to be upgraded, got: %v %v %v", ok, rehash, err)
+	}
+
+	if _, _, err := argon2Hasher.Verify("Tr0ub4dor&3", "plaintext"); err != ErrUnknownFormat {
+		t.Errorf("Expected unknown format error, got: %v", err)
+	}
+}
+
+func TestHasherArgon2Params(t *testing.T) {
+	hasher, _ := NewHasher(testHashConfig("argon2id"))
+	hash, _ := hasher.Hash("Tr0ub4dor&3")
+	parts := strings.Split(hash, "$")
+	for _, params := range []string{"m=65536,t=0,p=2", "m=65536,t=3,p=0", "m=4294967295,t=3,p=2", "m=8,t=3,p=2"} {
+		parts[3] = params
+		if _, _, err := hasher.Verify("Tr0ub4dor&3", strings.Join(parts, "$")); err != ErrUnknownFormat {
+			t.Errorf("Expected unknown format error for %s, got: %v", params, err)
+		}
+	}
+}
+
+func TestHasherScryptParams(t *testing.T) {
+	hasher, _ := NewHasher(testHashConfig("scrypt"))
+	hash, _ := hasher.Hash("Tr0ub4dor&3")
+	parts := strings.Split(hash, "$")
+	for _, params := range []string{"ln=0,r=8,p=1", "ln=15,r=0,p=1", "ln=15,r=8,p=0", "ln=15,r=8,p=1000", "ln=30,r=8,p=1", "ln=15,r=1048576,p=1"} {
+		parts[2] = params
+		if _, _, err := hasher.Verify("Tr0ub4dor&3", strings.Join(parts, "$")); err != ErrUnknownFormat {
+			t.Errorf("Expected unknown format error for %s, got: %v", params, err)
+		}
+	}
+}
+
+func TestFirebaseScrypt(t *testing.T) {
+	// Sample parameters from https://github.com/firebase/scrypt
+	hash, err := FirebaseScryptHash(
+		"jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA==",
+		"Bw==", 8, 14,
+		"42xEC+ixf3L2lw==",
+		"lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ==",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !Supported(hash) {
+		t.Errorf("Expected %v to be supported", hash)
+	}
+	hasher, _ := NewHasher(testHashConfig("argon2id"))
+	ok, rehash, err := hasher.Verify("user1password", hash)
+	if !ok || !rehash || err != nil {
+		t.Errorf("Expected firebase hash to match and be upgraded, got: %v %v %v", ok, rehash, err)
+	}
+	ok, _, _ = hasher.Verify("user2password", hash)
+	if ok {
+		t.Errorf("Expected firebase hash not to match another password")
+	}
+	parts := strings.Split(hash, "$")
+	for _, params := range []string{"r=0,m=14", "r=8,m=30", "r=1000000,m=14"} {
+		parts[2] = params
+		if _, _, err := hasher.Verify("user1password", strings.Join(parts, "$")); err != ErrUnknownFormat {
+			t.Errorf("Expected unknown format error for %s, got: %v", params, err)
+		}
+	}
+}
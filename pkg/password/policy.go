@@ -0,0 +1,116 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+// Violation describes a password policy rule that the password doesn't match
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy validates passwords against the configured rules
+type Policy struct {
+	config   *config.Password
+	hash     *config.Hash
+	breached Corpus
+}
+
+// NewPolicy creates a new Policy, loading the breached passwords corpus when configured
+// The hashing configuration limits the length of the passwords when bcrypt is used
+func NewPolicy(config *config.Password, hash *config.Hash) (*Policy, error) {
+	p := &Policy{
+		config: config,
+		hash:   hash,
+	}
+	if config.BreachedCorpus != "" {
+		corpus, err := OpenCorpus(config.BreachedCorpus)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = corpus
+	}
+	return p, nil
+}
+
+// Validate checks the password of the user owning the provided email
+// It returns every rule the password doesn't match, or an empty list when the password is valid
+func (p *Policy) Validate(password, email string) ([]Violation, error) {
+	violations := []Violation{}
+	length := utf8.RuneCountInString(password)
+	if length < p.config.MinLength {
+		violations = append(violations, Violation{"min_length", fmt.Sprintf("Your password must contain at least %v characters", p.config.MinLength)})
+	}
+	if p.config.MaxLength > 0 && length > p.config.MaxLength {
+		violations = append(violations, Violation{"max_length", fmt.Sprintf("Your password must contain at most %v characters", p.config.MaxLength)})
+	}
+	if p.hash.Algorithm == "bcrypt" && len(password) > BcryptMaxLength {
+		violations = append(violations, Violation{"max_bytes", fmt.Sprintf("Your password must contain at most %v bytes", BcryptMaxLength)})
+	}
+	classes := characterClasses(password)
+	if p.config.RequireLower && !classes.lower {
+		violations = append(violations, Violation{"lowercase", "Your password must contain a lowercase letter"})
+	}
+	if p.config.RequireUpper && !classes.upper {
+		violations = append(violations, Violation{"uppercase", "Your password must contain an uppercase letter"})
+	}
+	if p.config.RequireDigit && !classes.digit {
+		violations = append(violations, Violation{"digit", "Your password must contain a digit"})
+	}
+	if p.config.RequireSymbol && !classes.symbol {
+		violations = append(violations, Violation{"symbol", "Your password must contain a symbol"})
+	}
+	if Score(password) < p.config.MinScore {
+		violations = append(violations, Violation{"score", "Your password is too easy to guess"})
+	}
+	if p.config.ForbidEmail && containsEmail(password, email) {
+		violations = append(violations, Violation{"email", "Your password must not contain your email address"})
+	}
+	if p.breached != nil {
+		breached, err := p.breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, Violation{"breached", "Your password appeared in a data breach, please choose another one"})
+		}
+	}
+	return violations, nil
+}
+
+type classes struct {
+	lower, upper, digit, symbol bool
+}
+
+// characterClasses returns the character classes used in the password
+func characterClasses(password string) classes {
+	var c classes
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			c.lower = true
+		case unicode.IsUpper(r):
+			c.upper = true
+		case unicode.IsDigit(r):
+			c.digit = true
+		default:
+			c.symbol = true
+		}
+	}
+	return c
+}
+
+// containsEmail checks if the password contains the email address or its local part
+func containsEmail(password, email string) bool {
+	local := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	if len(local) < 3 {
+		return false
+	}
+	return strings.Contains(strings.ToLower(password), local)
+}
@@ -0,0 +1,126 @@
+package password
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+func rules(violations []Violation) []string {
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy, err := NewPolicy(&config.Password{
+		MinLength:     8,
+		MaxLength:     16,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		MinScore:      2,
+		ForbidEmail:   true,
+	}, testHashConfig("argon2id"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tests := []struct {
+		password string
+		rules    []string
+	}{
+		{"", []string{"min_length", "uppercase", "digit", "symbol", "score"}},
+		{"Tr0ub4dor&3", []string{}},
+		{"password", []string{"uppercase", "digit", "symbol", "score"}},
+		{"Tr0ub4dor&3Tr0ub4dor&3", []string{"max_length"}},
+		{"Alexandre&1234", []string{"email"}},
+	}
+	for _, test := range tests {
+		violations, err := policy.Validate(test.password, "alexandre@google.com")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(rules(violations), test.rules) {
+			t.Errorf("Expected %q to fail %v rules, got: %v", test.password, test.rules, rules(violations))
+		}
+	}
+}
+
+func TestPolicyBcryptLength(t *testing.T) {
+	passwordConfig := &config.Password{MaxLength: 128}
+	password := strings.Repeat("é", 40)
+	for algorithm, expected := range map[string][]string{"argon2id": {}, "bcrypt": {"max_bytes"}} {
+		policy, _ := NewPolicy(passwordConfig, testHashConfig(algorithm))
+		violations, err := policy.Validate(password, "alexandre@google.com")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(rules(violations), expected) {
+			t.Errorf("Expected %v to fail %v rules, got: %v", algorithm, expected, rules(violations))
+		}
+	}
+	hasher, _ := NewHasher(testHashConfig("bcrypt"))
+	if _, err := hasher.Hash(password); err != ErrTooLong {
+		t.Errorf("Expected too long error, got: %v", err)
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		password string
+		score    int
+	}{
+		{"", 0},
+		{"password", 0},
+		{"Password123", 0},
+		{"aaaaaaaaaaaa", 0},
+		{"abcdefgh", 1},
+		{"Tr0ub4dor&3", 4},
+	}
+	for _, test := range tests {
+		if score := Score(test.password); score != test.score {
+			t.Errorf("Expected %q score to be %v, got: %v", test.password, test.score, score)
+		}
+	}
+}
+
+func TestBreachedCorpus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	ranges := filepath.Join(dir, "ranges")
+	os.Mkdir(ranges, 0755)
+	ioutil.WriteFile(filepath.Join(ranges, "5BAA6"), []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n"), 0644)
+
+	filter := NewBloomFilter(1024, 4)
+	filter.Add(sha1Hex("password"))
+	buf := new(bytes.Buffer)
+	filter.WriteTo(buf)
+	bloom := filepath.Join(dir, "breached.bloom")
+	ioutil.WriteFile(bloom, buf.Bytes(), 0644)
+
+	for _, path := range []string{ranges, bloom} {
+		corpus, err := OpenCorpus(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ok, _ := corpus.Contains("password"); !ok {
+			t.Errorf("Expected %v to contain password", path)
+		}
+		if ok, _ := corpus.Contains("Tr0ub4dor&3"); ok {
+			t.Errorf("Expected %v not to contain Tr0ub4dor&3", path)
+		}
+	}
+}
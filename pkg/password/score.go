@@ -0,0 +1,71 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are the most used passwords, they are scored 0 whatever their length
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "123456": true, "12345678": true, "123456789": true,
+	"1234567890": true, "qwerty": true, "qwertyuiop": true, "azerty": true, "abc123": true,
+	"111111": true, "123123": true, "letmein": true, "welcome": true, "monkey": true,
+	"dragon": true, "football": true, "baseball": true, "iloveyou": true, "admin": true,
+	"login": true, "princess": true, "sunshine": true, "master": true, "shadow": true,
+	"superman": true, "trustno1": true, "starwars": true, "whatever": true, "secret": true,
+}
+
+// Score estimates the strength of the password on a 0 to 4 scale, like zxcvbn does
+// The number of guesses is estimated from the character pool size, with a penalty for repeated
+// and sequential characters; common passwords are always scored 0
+func Score(password string) int {
+	base := strings.ToLower(strings.TrimRightFunc(password, unicode.IsDigit))
+	if password == "" || commonPasswords[base] || commonPasswords[strings.ToLower(password)] {
+		return 0
+	}
+
+	classes := characterClasses(password)
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+
+	bits := 0.0
+	var previous rune
+	for i, r := range []rune(password) {
+		delta := r - previous
+		switch {
+		case i > 0 && delta == 0:
+			// Repeated characters are free to guess
+		case i > 0 && (delta == -1 || delta == 1):
+			// Sequential characters are almost free to guess
+			bits++
+		default:
+			bits += math.Log2(float64(pool))
+		}
+		previous = r
+	}
+
+	switch {
+	case bits < 10:
+		return 0
+	case bits < 20:
+		return 1
+	case bits < 27:
+		return 2
+	case bits < 33:
+		return 3
+	default:
+		return 4
+	}
+}
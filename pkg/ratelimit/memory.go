@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryStore keeps the buckets in memory, it's only suitable for single instance deployments
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+// memoryBucket is a bucket with the time it will be full again
+type memoryBucket struct {
+	bucket
+	refilled time.Time
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+func (s *memoryStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: bucket{tokens: float64(limit.Burst), updated: now}}
+		s.buckets[key] = b
+	}
+	allowed, wait := b.take(limit, now)
+	b.refilled = b.bucket.refilled(limit)
+	return allowed, wait, nil
+}
+
+// sweep removes the buckets which are full again, to keep memory usage bounded
+// A full bucket is the same as a missing one, so the limits are kept whatever their period
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !b.refilled.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// postgresStore keeps the buckets in the rate_limits table, so they are shared across replicas
+type postgresStore struct {
+	db        *sql.DB
+	table     string
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresStore creates a new store backed by the provided postgres table
+func NewPostgresStore(db *sql.DB, table string) Store {
+	return &postgresStore{
+		db:    db,
+		table: table,
+	}
+}
+
+func (s *postgresStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	if err := s.sweep(now); err != nil {
+		return false, 0, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO "+s.table+"(key, tokens, updated_at) VALUES($1, $2, $3) ON CONFLICT (key) DO NOTHING", key, limit.Burst, now)
+	if err != nil {
+		return false, 0, err
+	}
+	var b bucket
+	err = tx.QueryRow("SELECT tokens, updated_at FROM "+s.table+" WHERE key = $1 FOR UPDATE", key).Scan(&b.tokens, &b.updated)
+	if err != nil {
+		return false, 0, err
+	}
+	allowed, wait := b.take(limit, now)
+	_, err = tx.Exec("UPDATE "+s.table+" SET tokens = $1, updated_at = $2, refilled_at = $3 WHERE key = $4", b.tokens, b.updated, b.refilled(limit), key)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, wait, tx.Commit()
+}
+
+// sweep deletes the buckets which are full again, like the memory store
+func (s *postgresStore) sweep(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return nil
+	}
+	s.lastSweep = now
+	_, err := s.db.Exec("DELETE FROM "+s.table+" WHERE refilled_at <= $1", now)
+	return err
+}
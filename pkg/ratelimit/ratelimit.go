@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket definition: the bucket holds up to Burst tokens and is refilled by Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses a limit written as "<requests>/<duration>", for instance "10/1m"
+func ParseLimit(value string) (Limit, error) {
+	var limit Limit
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return limit, fmt.Errorf("invalid rate limit %q, expected <requests>/<duration>", value)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests <= 0 {
+		return limit, fmt.Errorf("invalid rate limit %q, requests must be a positive integer", value)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return limit, fmt.Errorf("invalid rate limit %q, period must be a positive duration", value)
+	}
+	limit.Burst = requests
+	limit.Rate = float64(requests) / period.Seconds()
+	return limit, nil
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// Take removes a token from the key's bucket
+	// When the bucket is empty, it returns false and how long to wait for the next token
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// NewStore creates the store matching the provided name, postgres stores use the provided table
+func NewStore(name string, db *sql.DB, table string) (Store, error) {
+	switch name {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "postgres":
+		return NewPostgresStore(db, table), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store: %s", name)
+	}
+}
+
+// bucket is the state of a token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket according to the elapsed time, then tries to remove a token from it
+func (b *bucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * limit.Rate
+	}
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// refilled returns when the bucket will be full again, it can then be forgotten
+func (b *bucket) refilled(limit Limit) time.Time {
+	missing := float64(limit.Burst) - b.tokens
+	return b.updated.Add(time.Duration(missing / limit.Rate * float64(time.Second)))
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		limit Limit
+		valid bool
+	}{
+		{"10/1s", Limit{Rate: 10, Burst: 10}, true},
+		{"60/1m", Limit{Rate: 1, Burst: 60}, true},
+		{"10", Limit{}, false},
+		{"0/1m", Limit{}, false},
+		{"10/forever", Limit{}, false},
+	}
+	for _, test := range tests {
+		limit, err := ParseLimit(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("Expected %v validity to be %v, got error: %v", test.value, test.valid, err)
+		}
+		if limit != test.limit {
+			t.Errorf("Expected %v to be parsed as %v, got: %v", test.value, test.limit, limit)
+		}
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take("key", limit, now); !ok {
+			t.Errorf("Expected request %v to be allowed", i+1)
+		}
+	}
+	ok, wait, _ := store.Take("key", limit, now)
+	if ok || wait != time.Second {
+		t.Errorf("Expected request to be rejected for 1s, got: %v %v", ok, wait)
+	}
+	if ok, _, _ := store.Take("other", limit, now); !ok {
+		t.Errorf("Expected buckets to be separated by key")
+	}
+	if ok, _, _ := store.Take("key", limit, now.Add(time.Second)); !ok {
+		t.Errorf("Expected bucket to be refilled after 1s")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+	limit, _ := ParseLimit("2/24h")
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	store.Take("key", limit, now)
+	store.Take("key", limit, now)
+	store.Take("refilled", limit, now)
+	now = now.Add(12*time.Hour + time.Minute)
+	store.Take("other", limit, now)
+	if _, ok := store.buckets["refilled"]; ok {
+		t.Errorf("Expected the refilled bucket to be removed")
+	}
+	if _, ok := store.buckets["key"]; !ok {
+		t.Errorf("Expected the bucket to be kept until it's refilled")
+	}
+}
@@ -0,0 +1,15 @@
+package retry
+
+import "time"
+
+// Backoff returns the delay before the next attempt, doubling from base after each failed attempt, up to max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
@@ -0,0 +1,26 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, test := range tests {
+		if got := Backoff(test.attempts, 30*time.Second, 6*time.Hour); got != test.expected {
+			t.Errorf("Backoff(%v) = %v, want %v", test.attempts, got, test.expected)
+		}
+	}
+}
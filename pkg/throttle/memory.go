@@ -0,0 +1,69 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryStore keeps the counters in memory, it's only suitable for single instance deployments
+type memoryStore struct {
+	mu        sync.Mutex
+	attempts  map[string]Attempts
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		attempts: make(map[string]Attempts),
+	}
+}
+
+func (s *memoryStore) Get(key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *memoryStore) Fail(key string, now, since time.Time) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now, since)
+	attempts := s.attempts[key]
+	if expired(attempts, now, since) {
+		attempts = Attempts{}
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	s.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (s *memoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts := s.attempts[key]
+	attempts.LockedUntil = until
+	s.attempts[key] = attempts
+	return nil
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep removes the keys whose failures expired, to keep memory usage bounded
+func (s *memoryStore) sweep(now, since time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, attempts := range s.attempts {
+		if expired(attempts, now, since) {
+			delete(s.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package throttle
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// expiredCondition matches the rows whose failures are no longer counted, like the expired function
+// now and since are the placeholders of the current time and of the window start
+func expiredCondition(now, since string) string {
+	return "((a.locked_until IS NULL AND a.last_failure < " + since + ") OR a.locked_until <= " + now + ")"
+}
+
+// postgresStore keeps the counters in the login_attempts table, so they are shared across replicas
+type postgresStore struct {
+	db        *sql.DB
+	table     string
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresStore creates a new store backed by the provided postgres table
+func NewPostgresStore(db *sql.DB, table string) Store {
+	return &postgresStore{
+		db:    db,
+		table: table,
+	}
+}
+
+func (s *postgresStore) Get(key string) (Attempts, error) {
+	var attempts Attempts
+	var lockedUntil pq.NullTime
+	err := s.db.QueryRow("SELECT failures, last_failure, locked_until FROM "+s.table+" WHERE key = $1", key).Scan(&attempts.Failures, &attempts.LastFailure, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return attempts, nil
+	}
+	attempts.LockedUntil = lockedUntil.Time
+	return attempts, err
+}
+
+func (s *postgresStore) Fail(key string, now, since time.Time) (Attempts, error) {
+	if err := s.sweep(now, since); err != nil {
+		return Attempts{}, err
+	}
+	var attempts Attempts
+	var lockedUntil pq.NullTime
+	err := s.db.QueryRow("INSERT INTO "+s.table+` AS a(key, failures, last_failure) VALUES($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN `+expiredCondition("$2", "$3")+` THEN 1 ELSE a.failures + 1 END,
+			locked_until = CASE WHEN `+expiredCondition("$2", "$3")+` THEN NULL ELSE a.locked_until END,
+			last_failure = EXCLUDED.last_failure
+		RETURNING failures, last_failure, locked_until`, key, now, since).Scan(&attempts.Failures, &attempts.LastFailure, &lockedUntil)
+	attempts.LockedUntil = lockedUntil.Time
+	return attempts, err
+}
+
+func (s *postgresStore) Lock(key string, until time.Time) error {
+	_, err := s.db.Exec("UPDATE "+s.table+" SET locked_until = $1 WHERE key = $2", until, key)
+	return err
+}
+
+func (s *postgresStore) Reset(key string) error {
+	_, err := s.db.Exec("DELETE FROM "+s.table+" WHERE key = $1", key)
+	return err
+}
+
+// sweep deletes the rows whose failures expired, to keep the table size bounded
+func (s *postgresStore) sweep(now, since time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return nil
+	}
+	s.lastSweep = now
+	_, err := s.db.Exec("DELETE FROM "+s.table+" AS a WHERE "+expiredCondition("$1", "$2"), now, since)
+	return err
+}
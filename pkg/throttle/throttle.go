@@ -0,0 +1,152 @@
+package throttle
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+// Attempts represents the failed attempts state of a key
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists the failed attempts counters
+type Store interface {
+	// Get returns the attempts state of the key
+	Get(key string) (Attempts, error)
+	// Fail increments the failures counter of the key and returns its new state
+	// The counter restarts when the last failure happened before since, or when the key lockout has ended
+	Fail(key string, now, since time.Time) (Attempts, error)
+	// Lock locks the key until the provided time
+	Lock(key string, until time.Time) error
+	// Reset removes every failed attempt of the key
+	Reset(key string) error
+}
+
+// NewStore creates the store matching the provided name, postgres stores use the provided table
+func NewStore(name string, db *sql.DB, table string) (Store, error) {
+	switch name {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "postgres":
+		return NewPostgresStore(db, table), nil
+	default:
+		return nil, fmt.Errorf("unknown throttle store: %s", name)
+	}
+}
+
+// Throttler applies an exponential backoff and a temporary lockout on failed attempts
+type Throttler struct {
+	store  Store
+	config *config.Throttle
+	now    func() time.Time
+}
+
+// New creates a new Throttler using the provided store
+func New(store Store, config *config.Throttle) *Throttler {
+	return &Throttler{
+		store:  store,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// AccountKey returns the throttling key of an account
+func AccountKey(email string) string {
+	return "account:" + email
+}
+
+// IPKey returns the throttling key of a client ip
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the caller has to wait before trying again with the provided keys
+func (t *Throttler) Check(keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	now := t.now()
+	for _, key := range keys {
+		attempts, err := t.get(key, now)
+		if err != nil {
+			return 0, err
+		}
+		if w := t.wait(attempts, now); w > wait {
+			wait = w
+		}
+	}
+	return wait, nil
+}
+
+// Failures returns the number of failed attempts of the key
+func (t *Throttler) Failures(key string) (int, error) {
+	attempts, err := t.get(key, t.now())
+	if err != nil {
+		return 0, err
+	}
+	return attempts.Failures, nil
+}
+
+// Fail records a failed attempt for the key, and locks it once max failures are reached
+// It returns true when the key has just been locked
+func (t *Throttler) Fail(key string, max int) (bool, error) {
+	now := t.now()
+	attempts, err := t.store.Fail(key, now, now.Add(-t.config.FailureWindow))
+	if err != nil {
+		return false, err
+	}
+	if max <= 0 || attempts.Failures < max || attempts.LockedUntil.After(now) {
+		return false, nil
+	}
+	return true, t.store.Lock(key, now.Add(t.config.LockoutDuration))
+}
+
+// Reset removes the failed attempts of the key
+func (t *Throttler) Reset(key string) error {
+	return t.store.Reset(key)
+}
+
+// get returns the attempts state of the key, the expired failures aren't counted
+func (t *Throttler) get(key string, now time.Time) (Attempts, error) {
+	attempts, err := t.store.Get(key)
+	if err != nil {
+		return attempts, err
+	}
+	if expired(attempts, now, now.Add(-t.config.FailureWindow)) {
+		return Attempts{}, nil
+	}
+	return attempts, nil
+}
+
+// expired checks if the failures of the attempts state are no longer counted
+func expired(attempts Attempts, now, since time.Time) bool {
+	if attempts.LockedUntil.IsZero() {
+		return attempts.LastFailure.Before(since)
+	}
+	return !attempts.LockedUntil.After(now)
+}
+
+// wait computes the remaining time before a new attempt is allowed
+func (t *Throttler) wait(attempts Attempts, now time.Time) time.Duration {
+	if attempts.LockedUntil.After(now) {
+		return attempts.LockedUntil.Sub(now)
+	}
+	if attempts.Failures == 0 {
+		return 0
+	}
+	delay := t.config.BaseDelay
+	for i := 1; i < attempts.Failures && delay < t.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.config.MaxDelay {
+		delay = t.config.MaxDelay
+	}
+	if wait := attempts.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+func TestThrottlerBackoff(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	throttler := New(NewMemoryStore(), &config.Throttle{
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutDuration: time.Hour,
+	})
+	throttler.now = func() time.Time { return now }
+
+	tests := []struct {
+		wait time.Duration
+	}{
+		{time.Second},
+		{2 * time.Second},
+		{4 * time.Second},
+		{8 * time.Second},
+		{10 * time.Second},
+	}
+	for i, test := range tests {
+		if _, err := throttler.Fail("key", 0); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		wait, err := throttler.Check("other", "key")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if wait != test.wait {
+			t.Errorf("Expected wait after %v failures to be %v, got: %v", i+1, test.wait, wait)
+		}
+	}
+
+	now = now.Add(10 * time.Second)
+	wait, _ := throttler.Check("key")
+	if wait != 0 {
+		t.Errorf("Expected wait to be elapsed, got: %v", wait)
+	}
+}
+
+func TestThrottlerLockout(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	throttler := New(NewMemoryStore(), &config.Throttle{
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Second,
+		LockoutDuration: time.Hour,
+	})
+	throttler.now = func() time.Time { return now }
+
+	for i := 1; i <= 3; i++ {
+		locked, err := throttler.Fail("key", 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if locked != (i == 3) {
+			t.Errorf("Expected locked after %v failures to be %v, got: %v", i, i == 3, locked)
+		}
+	}
+	wait, _ := throttler.Check("key")
+	if wait != time.Hour {
+		t.Errorf("Expected key to be locked for %v, got: %v", time.Hour, wait)
+	}
+
+	throttler.Reset("key")
+	wait, _ = throttler.Check("key")
+	if wait != 0 {
+		t.Errorf("Expected key to be unlocked, got: %v", wait)
+	}
+}
+
+func TestThrottlerFailureWindow(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	throttler := New(store, &config.Throttle{
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Second,
+		LockoutDuration: time.Hour,
+		FailureWindow:   10 * time.Minute,
+	})
+	throttler.now = func() time.Time { return now }
+
+	throttler.Fail("key", 3)
+	throttler.Fail("key", 3)
+	now = now.Add(11 * time.Minute)
+	if failures, _ := throttler.Failures("key"); failures != 0 {
+		t.Errorf("Expected the failures to be expired, got: %v", failures)
+	}
+	if locked, _ := throttler.Fail("key", 3); locked {
+		t.Error("Expected the expired failures to be discarded")
+	}
+
+	throttler.Fail("key", 3)
+	if locked, _ := throttler.Fail("key", 3); !locked {
+		t.Fatal("Expected the key to be locked")
+	}
+	now = now.Add(time.Hour)
+	if wait, _ := throttler.Check("key"); wait != 0 {
+		t.Errorf("Expected the lockout to be ended, got: %v", wait)
+	}
+	if failures, _ := throttler.Failures("key"); failures != 0 {
+		t.Errorf("Expected the failures to restart after the lockout, got: %v", failures)
+	}
+	if locked, _ := throttler.Fail("key", 3); locked {
+		t.Error("Expected the key not to be locked again after a single failure")
+	}
+
+	now = now.Add(time.Hour)
+	throttler.Fail("other", 3)
+	if _, ok := store.(*memoryStore).attempts["key"]; ok {
+		t.Error("Expected the expired key to be evicted")
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/events"
+	"github.com/labstack/gommon/log"
+)
+
+// eventTypes maps the database events to the webhook events
+var eventTypes = map[string]string{
+	events.UserSignedUp:      EventUserCreated,
+	events.UserConfirmed:     EventUserConfirmed,
+	events.UserPasswordReset: EventPasswordReset,
+	events.UserDeleted:       EventUserDeleted,
+}
+
+// Relay records the deliveries of the database events until the context is done
+// The id of the last relayed event is kept in the cursor table, so no event is lost or relayed twice across restarts and replicas
+func (s *Store) Relay(ctx context.Context, subscriber *events.Subscriber, cursorTable string, logger *log.Logger) {
+	for {
+		var cursor int64
+		err := s.db.QueryRow("SELECT event_id FROM " + cursorTable).Scan(&cursor)
+		if err == nil {
+			err = subscriber.Subscribe(ctx, cursor, func(event events.Event) error {
+				return s.relay(event, cursorTable)
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("An error occurred while relaying events to webhooks: %v \n", err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 5):
+		}
+	}
+}
+
+// relay records the deliveries of the event and moves the cursor in the same transaction
+func (s *Store) relay(event events.Event, cursorTable string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var cursor int64
+	if err := tx.QueryRow("SELECT event_id FROM " + cursorTable + " FOR UPDATE").Scan(&cursor); err != nil {
+		return err
+	}
+	// Another replica already relayed it
+	if event.ID <= cursor {
+		return nil
+	}
+	if eventType, ok := eventTypes[event.Type]; ok {
+		if err := s.trigger(tx, eventType, event.Payload); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE "+cursorTable+" SET event_id = $1", event.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/lib/pq"
+)
+
+// The events sent to the webhook endpoints
+const (
+	EventUserCreated   = "user.created"
+	EventUserConfirmed = "user.confirmed"
+	EventUserSignedIn  = "user.signed_in"
+	EventPasswordReset = "password.reset"
+	EventUserDeleted   = "user.deleted"
+)
+
+// The statuses of a delivery
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Delivery is the call of an endpoint for an event
+type Delivery struct {
+	ID            int64           `json:"id"`
+	Endpoint      string          `json:"endpoint"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     *string         `json:"last_error"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// payload is the body sent to the endpoints
+type payload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Store records the deliveries of the webhooks
+type Store struct {
+	db        *sql.DB
+	table     string
+	endpoints []string
+	events    map[string]bool
+}
+
+// NewStore creates a new Store recording the deliveries in the provided table
+func NewStore(db *sql.DB, table string, config *config.Webhook) *Store {
+	events := make(map[string]bool)
+	for _, event := range config.Events {
+		events[event] = true
+	}
+	return &Store{
+		db:        db,
+		table:     table,
+		endpoints: config.Endpoints,
+		events:    events,
+	}
+}
+
+// Enabled tells if the event must be sent to the endpoints
+func (s *Store) Enabled(event string) bool {
+	if len(s.endpoints) == 0 {
+		return false
+	}
+	return len(s.events) == 0 || s.events[event]
+}
+
+// Trigger records a delivery of the event for every endpoint
+func (s *Store) Trigger(event string, data interface{}) error {
+	return s.trigger(s.db, event, data)
+}
+
+func (s *Store) trigger(db execer, event string, data interface{}) error {
+	if !s.Enabled(event) {
+		return nil
+	}
+	body, err := json.Marshal(payload{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range s.endpoints {
+		_, err := db.Exec("INSERT INTO "+s.table+"(endpoint, event, payload) VALUES($1, $2, $3)", endpoint, event, string(body))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the last deliveries, optionally filtered by status
+func (s *Store) List(status string, limit int) ([]Delivery, error) {
+	rows, err := s.db.Query("SELECT id, endpoint, event, payload, status, attempts, last_error, next_attempt_at, delivered_at, created_at FROM "+s.table+" WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2", status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var delivery Delivery
+		var lastError sql.NullString
+		var deliveredAt pq.NullTime
+		err := rows.Scan(&delivery.ID, &delivery.Endpoint, &delivery.Event, &delivery.Payload, &delivery.Status, &delivery.Attempts, &lastError, &delivery.NextAttemptAt, &deliveredAt, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if lastError.Valid {
+			delivery.LastError = &lastError.String
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// Retry schedules a new delivery attempt, returning sql.ErrNoRows when the delivery doesn't exist
+func (s *Store) Retry(id int64) error {
+	result, err := s.db.Exec("UPDATE "+s.table+" SET status = $1, attempts = 0, next_attempt_at = now() WHERE id = $2", StatusPending, id)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Sign computes the signature of the body, sent in the X-Webhook-Signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
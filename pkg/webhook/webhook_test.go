@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+)
+
+func TestSign(t *testing.T) {
+	// Computed using: echo -n '{"event":"user.created"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=e851f51160ef29a5847ccec510a3d5b801d448e9f8d769e8484a75fb4b9f6947"
+	got := Sign("secret", []byte(`{"event":"user.created"}`))
+	if got != expected {
+		t.Errorf("Sign() = %v, want %v", got, expected)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	store := NewStore(nil, "", &config.Webhook{})
+	if store.Enabled(EventUserCreated) {
+		t.Error("Enabled() should be false without endpoints")
+	}
+
+	store = NewStore(nil, "", &config.Webhook{Endpoints: []string{"http://localhost/hook"}})
+	if !store.Enabled(EventUserSignedIn) {
+		t.Error("Enabled() should be true for every event when no event is configured")
+	}
+
+	store = NewStore(nil, "", &config.Webhook{Endpoints: []string{"http://localhost/hook"}, Events: []string{EventUserCreated}})
+	if !store.Enabled(EventUserCreated) || store.Enabled(EventUserSignedIn) {
+		t.Error("Enabled() should only be true for the configured events")
+	}
+}
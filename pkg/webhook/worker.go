@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexandrevilain/postgrest-auth/pkg/config"
+	"github.com/alexandrevilain/postgrest-auth/pkg/retry"
+	"github.com/labstack/gommon/log"
+)
+
+// The delays between two attempts of a delivery
+const (
+	backoffBase = 30 * time.Second
+	backoffMax  = 6 * time.Hour
+)
+
+// pollBatch is the maximum number of deliveries claimed at once
+const pollBatch = 10
+
+// Worker polls the pending deliveries and calls the endpoints
+type Worker struct {
+	db          *sql.DB
+	table       string
+	secret      string
+	maxAttempts int
+	interval    time.Duration
+	client      *http.Client
+	quitChan    chan bool
+	logger      *log.Logger
+}
+
+// NewWorker creates, and returns a new Worker object delivering the webhooks recorded in the provided table.
+func NewWorker(db *sql.DB, table string, config *config.Webhook, logger *log.Logger) *Worker {
+	return &Worker{
+		db:          db,
+		table:       table,
+		secret:      config.Secret,
+		maxAttempts: config.MaxAttempts,
+		interval:    config.Interval,
+		client:      &http.Client{Timeout: config.Timeout},
+		quitChan:    make(chan bool),
+		logger:      logger,
+	}
+}
+
+// Start launches the worker by starting a goroutine
+func (w *Worker) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.poll(); err != nil {
+					w.logger.Errorf("An error occurred while delivering webhooks: %v \n", err.Error())
+				}
+			case <-w.quitChan:
+				w.logger.Info("Stopping webhook worker ...\n")
+				return
+			}
+		}
+	}()
+}
+
+// Stop tells the worker to stop delivering webhooks.
+func (w *Worker) Stop() {
+	go func() {
+		w.quitChan <- true
+	}()
+}
+
+// poll claims the due webhooks then delivers them, the claim delays their next attempt so concurrent replicas skip them
+// The claim is committed before the deliveries, so no lock is held during the requests
+func (w *Worker) poll() error {
+	// The claim lasts longer than the deliveries, they are only retried if the replica stopped while delivering them
+	lease := time.Duration(pollBatch)*w.client.Timeout + time.Minute
+	rows, err := w.db.Query(`UPDATE `+w.table+` SET next_attempt_at = now() + $1 * interval '1 second'
+		WHERE id IN (SELECT id FROM `+w.table+` WHERE status = $2 AND next_attempt_at <= now() ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING id, endpoint, event, payload, attempts`, lease.Seconds(), StatusPending, pollBatch)
+	if err != nil {
+		return err
+	}
+	var deliveries []Delivery
+	for rows.Next() {
+		var delivery Delivery
+		if err := rows.Scan(&delivery.ID, &delivery.Endpoint, &delivery.Event, &delivery.Payload, &delivery.Attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+
+	for _, delivery := range deliveries {
+		attempts := delivery.Attempts + 1
+		if deliverErr := w.deliver(delivery); deliverErr != nil {
+			w.logger.Warnf("Webhook delivery %v to %v failed: %v \n", delivery.ID, delivery.Endpoint, deliverErr.Error())
+			status := StatusPending
+			if attempts >= w.maxAttempts {
+				status = StatusFailed
+			}
+			_, err = w.db.Exec("UPDATE "+w.table+" SET status = $1, attempts = $2, last_error = $3, next_attempt_at = now() + $4 * interval '1 second' WHERE id = $5", status, attempts, deliverErr.Error(), retry.Backoff(attempts, backoffBase, backoffMax).Seconds(), delivery.ID)
+		} else {
+			_, err = w.db.Exec("UPDATE "+w.table+" SET status = $1, attempts = $2, last_error = NULL, delivered_at = now() WHERE id = $3", StatusDelivered, attempts, delivery.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver posts the signed payload to the endpoint
+func (w *Worker) deliver(delivery Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.Endpoint, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(w.secret, delivery.Payload))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", res.StatusCode)
+	}
+	return nil
+}